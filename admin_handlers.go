@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// recentJobsLimit is how many queue jobs handleJobStatus lists.
+const recentJobsLimit = 50
+
+type periodicJobResp struct {
+	Name         string     `json:"name"`
+	Interval     string     `json:"interval"`
+	Runs         int        `json:"runs"`
+	Failures     int        `json:"failures"`
+	FailStreak   int        `json:"fail_streak"`
+	Running      bool       `json:"running"`
+	LastRun      *time.Time `json:"last_run,omitempty"`
+	LastDuration string     `json:"last_duration,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	NextRun      time.Time  `json:"next_run"`
+}
+
+type queuedJobResp struct {
+	Id          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Kind        string     `json:"kind"`
+	Status      string     `json:"status"`
+	Attempts    int32      `json:"attempts"`
+	MaxAttempts int32      `json:"max_attempts"`
+	RunAt       time.Time  `json:"run_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+type jobQueueResp struct {
+	Counts map[string]int64 `json:"counts"`
+	Recent []queuedJobResp  `json:"recent"`
+}
+
+type jobStatusResp struct {
+	Periodic []periodicJobResp `json:"periodic"`
+	Queue    jobQueueResp      `json:"queue"`
+}
+
+// handleJobStatus shows this instance's periodic jobs and the shared queue:
+// job counts per status and the most recent jobs.
+func (cfg *apiConfig) handleJobStatus(w http.ResponseWriter, r *http.Request) {
+	counts, err := cfg.dbQueries.CountJobsByStatus(r.Context())
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't count jobs", err)
+		return
+	}
+	recent, err := cfg.dbQueries.ListJobs(r.Context(), recentJobsLimit)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't list jobs", err)
+		return
+	}
+
+	periodic := []periodicJobResp{}
+	for _, s := range cfg.scheduler.Status() {
+		res := periodicJobResp{
+			Name:       s.Name,
+			Interval:   s.Interval.String(),
+			Runs:       s.Runs,
+			Failures:   s.Failures,
+			FailStreak: s.FailStreak,
+			Running:    s.Running,
+			LastError:  s.LastError,
+			NextRun:    s.NextRun,
+		}
+		if !s.LastRun.IsZero() {
+			res.LastRun = &s.LastRun
+			res.LastDuration = s.LastDuration.String()
+		}
+		periodic = append(periodic, res)
+	}
+
+	byStatus := map[string]int64{}
+	for _, c := range counts {
+		byStatus[c.Status] = c.Count
+	}
+
+	queued := []queuedJobResp{}
+	for _, j := range recent {
+		queued = append(queued, queuedJobResp{
+			Id:          j.ID,
+			CreatedAt:   j.CreatedAt,
+			Kind:        j.Kind,
+			Status:      j.Status,
+			Attempts:    j.Attempts,
+			MaxAttempts: j.MaxAttempts,
+			RunAt:       j.RunAt,
+			FinishedAt:  nullTimePtr(j.FinishedAt),
+			LastError:   j.LastError.String,
+		})
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, http.StatusOK, jobStatusResp{
+		Periodic: periodic,
+		Queue: jobQueueResp{
+			Counts: byStatus,
+			Recent: queued,
+		},
+	})
+}
@@ -1,20 +1,28 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
+	"time"
 )
 
+// healthHandler is liveness only: the process is up and serving. It never
+// touches the database, so a database outage doesn't get us restarted.
 func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
 
 func (cfg *apiConfig) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	fmt.Fprintf(w, "Hits: %d", cfg.fileSeverHits.Load())
+	fmt.Fprintf(w, "Hits: %d\n", cfg.fileSeverHits.Load())
+	fmt.Fprintf(w, "DB queries timed out: %d\n", cfg.queryStats.TimedOut.Load())
+	fmt.Fprintf(w, "DB queries cancelled: %d\n", cfg.queryStats.Canceled.Load())
+	fmt.Fprintf(w, "Logins throttled: %d\n", cfg.throttledLogins.Load())
 }
 
 func (cfg *apiConfig) handleReset(w http.ResponseWriter, r *http.Request) {
@@ -22,3 +30,77 @@ func (cfg *apiConfig) handleReset(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Hits set to 0"))
 }
+
+// handleJWKS publishes the public half of every asymmetric key we sign or
+// still verify with, so other services can check our tokens on their own.
+func (cfg *apiConfig) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJson(w, http.StatusOK, cfg.keyring.JWKS())
+}
+
+const readyCheckTimeout = 2 * time.Second
+
+type componentStatus struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+	// migrations only
+	Version int64 `json:"version,omitempty"`
+	Pending int   `json:"pending,omitempty"`
+}
+
+// handleReady is readiness: whether this instance can do useful work right
+// now. 503 takes it out of the load balancer without restarting it.
+func (cfg *apiConfig) handleReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+	defer cancel()
+
+	components := map[string]componentStatus{}
+
+	start := time.Now()
+	db := componentStatus{Status: "ok"}
+	// unauthenticated, and driver errors name hosts and roles
+	if err := cfg.db.PingContext(ctx); err != nil {
+		log.Println("readiness: database:", err)
+		db.Status, db.Error = "error", "unreachable"
+	}
+	db.LatencyMs = time.Since(start).Milliseconds()
+	components["database"] = db
+
+	start = time.Now()
+	migrations := componentStatus{Status: "ok"}
+	statuses, err := cfg.migrator.Status(ctx)
+	if err != nil {
+		log.Println("readiness: migrations:", err)
+		migrations.Status, migrations.Error = "error", "couldn't read schema version"
+	}
+	// versions needn't be contiguous, so report the newest applied one
+	for _, s := range statuses {
+		if s.Applied {
+			migrations.Version = max(migrations.Version, s.Version)
+		} else {
+			migrations.Pending++
+		}
+	}
+	if migrations.Pending > 0 {
+		migrations.Status, migrations.Error = "error", "schema is behind, run migrate up"
+	}
+	migrations.LatencyMs = time.Since(start).Milliseconds()
+	components["migrations"] = migrations
+
+	status, code := "ok", http.StatusOK
+	for _, c := range components {
+		if c.Status != "ok" {
+			status, code = "error", http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, code, struct {
+		Status     string                     `json:"status"`
+		Components map[string]componentStatus `json:"components"`
+	}{
+		Status:     status,
+		Components: components,
+	})
+}
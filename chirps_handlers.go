@@ -1,44 +1,26 @@
 package main
 
 import (
-	"context"
-	"encoding/json"
-	"log"
+	"database/sql"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/sharath070/Chirpy/internal/auth"
 	"github.com/sharath070/Chirpy/internal/database"
 )
 
-func (cfg *apiConfig) handleCreateChirp(w http.ResponseWriter, r *http.Request) {
-	var params struct {
-		Body string `json:"body"`
-	}
-
-	// check for valid jwt token
-	authToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithErr(w, http.StatusBadRequest, "auth token not found", err)
-		return
-	}
+type chirpParams struct {
+	Body string `json:"body" validate:"required,max=140"`
+}
 
-	userId, err := auth.ValidateJWT(authToken, cfg.jwtSecret)
-	if err != nil {
-		respondWithErr(w, http.StatusUnauthorized, "unauthorized user", err)
-		return
-	}
+func (cfg *apiConfig) handleCreateChirp(w http.ResponseWriter, r *http.Request) {
+	userId := principal(r).UserID
 
-	err = json.NewDecoder(r.Body).Decode(&params)
+	params, err := decodeJSON[chirpParams](w, r)
 	if err != nil {
-		respondWithErr(w, http.StatusInternalServerError, "Error marshalling json", err)
-		return
-	}
-
-	if len(params.Body) > 140 {
-		respondWithErr(w, http.StatusBadRequest, "Chirp is too long", err)
+		respondWithDecodeErr(w, err)
 		return
 	}
 
@@ -50,7 +32,7 @@ func (cfg *apiConfig) handleCreateChirp(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	chirp, err := cfg.dbQueries.CreateChirp(context.Background(), database.CreateChirpParams{
+	chirp, err := cfg.dbQueries.CreateChirp(r.Context(), database.CreateChirpParams{
 		Body:   strings.Join(bodySlice, " "),
 		UserID: userId,
 	})
@@ -58,6 +40,7 @@ func (cfg *apiConfig) handleCreateChirp(w http.ResponseWriter, r *http.Request)
 		respondWithErr(w, http.StatusBadRequest, "Error inserting chirp", err)
 		return
 	}
+	cfg.publishChirp(r.Context(), eventChirpCreated, chirp)
 
 	res := struct {
 		Id        uuid.UUID `json:"id"`
@@ -77,15 +60,16 @@ func (cfg *apiConfig) handleCreateChirp(w http.ResponseWriter, r *http.Request)
 }
 
 type chirp struct {
-	Id        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserId    uuid.UUID `json:"user_id"`
+	Id        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Body      string     `json:"body"`
+	UserId    uuid.UUID  `json:"user_id"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 func (cfg *apiConfig) handleGetAllChirps(w http.ResponseWriter, r *http.Request) {
-	chirps, err := cfg.dbQueries.GetAllChirps(context.Background())
+	chirps, err := cfg.dbQueries.GetAllChirps(r.Context())
 	if err != nil {
 		respondWithErr(w, http.StatusInternalServerError, "Error getting chirps", err)
 		return
@@ -107,7 +91,6 @@ func (cfg *apiConfig) handleGetAllChirps(w http.ResponseWriter, r *http.Request)
 }
 
 func (cfg *apiConfig) handleGetChirp(w http.ResponseWriter, r *http.Request) {
-	log.Println("\n\n i am in get chipr")
 	chirpIdStr := r.PathValue("chirpID")
 	id, err := uuid.Parse(chirpIdStr)
 	if err != nil {
@@ -115,7 +98,7 @@ func (cfg *apiConfig) handleGetChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	c, err := cfg.dbQueries.GetChirp(context.Background(), id)
+	c, err := cfg.dbQueries.GetChirp(r.Context(), id)
 	if err != nil {
 		respondWithErr(w, http.StatusBadRequest, "Couldn't retrive chirp", err)
 		return
@@ -132,6 +115,11 @@ func (cfg *apiConfig) handleGetChirp(w http.ResponseWriter, r *http.Request) {
 	respondWithJson(w, http.StatusOK, chirpRes)
 }
 
+var errNotChirpOwner = errors.New("chirp belongs to another user")
+
+// handleDeleteChirp only marks the chirp deleted. Its author can bring it
+// back for chirpRestoreWindow, see handleRestoreChirp, and purgeDeletedChirps
+// removes it for good once chirpRetention has passed, see maintenance.go.
 func (cfg *apiConfig) handleDeleteChirp(w http.ResponseWriter, r *http.Request) {
 	chirpIdStr := r.PathValue("chirpID")
 	id, err := uuid.Parse(chirpIdStr)
@@ -140,11 +128,93 @@ func (cfg *apiConfig) handleDeleteChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	c, err := cfg.dbQueries.DeleteChirp(context.Background(), id)
+	var c database.Chirp
+	err = cfg.tx.InTx(r.Context(), func(q *database.Queries) error {
+		c, err = q.GetChirp(r.Context(), id)
+		if err != nil {
+			return err
+		}
+		if c.UserID != principal(r).UserID {
+			return errNotChirpOwner
+		}
+		c, err = q.SoftDeleteChirp(r.Context(), id)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithErr(w, http.StatusNotFound, "Couldn't find chirp", err)
+		return
+	}
+	if errors.Is(err, errNotChirpOwner) {
+		respondWithErr(w, http.StatusForbidden, "You can only delete your own chirps", nil)
+		return
+	}
 	if err != nil {
-		respondWithErr(w, http.StatusBadRequest, "Couldn't retrive chirp", err)
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't delete chirp", err)
+		return
+	}
+	cfg.publishChirp(r.Context(), eventChirpDeleted, c)
+
+	chirpRes := chirp{
+		Id:        c.ID,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+		Body:      c.Body,
+		UserId:    c.UserID,
+		DeletedAt: nullTimePtr(c.DeletedAt),
+	}
+
+	respondWithJson(w, http.StatusOK, chirpRes)
+}
+
+var (
+	errChirpNotDeleted     = errors.New("chirp is not deleted")
+	errRestoreWindowPassed = errors.New("restore window has passed")
+)
+
+func (cfg *apiConfig) handleRestoreChirp(w http.ResponseWriter, r *http.Request) {
+	chirpIdStr := r.PathValue("chirpID")
+	id, err := uuid.Parse(chirpIdStr)
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "invalid uuid format", err)
+		return
+	}
+
+	var c database.Chirp
+	err = cfg.tx.InTx(r.Context(), func(q *database.Queries) error {
+		c, err = q.GetChirpIncludingDeleted(r.Context(), id)
+		if err != nil {
+			return err
+		}
+		if c.UserID != principal(r).UserID {
+			return errNotChirpOwner
+		}
+		if !c.DeletedAt.Valid {
+			return errChirpNotDeleted
+		}
+		if time.Since(c.DeletedAt.Time) > cfg.chirpRestoreWindow {
+			return errRestoreWindowPassed
+		}
+		c, err = q.RestoreChirp(r.Context(), id)
+		return err
+	})
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		respondWithErr(w, http.StatusNotFound, "Couldn't find chirp", err)
+		return
+	case errors.Is(err, errNotChirpOwner):
+		respondWithErr(w, http.StatusForbidden, "You can only restore your own chirps", nil)
+		return
+	case errors.Is(err, errChirpNotDeleted):
+		respondWithErr(w, http.StatusConflict, "Chirp is not deleted", nil)
+		return
+	case errors.Is(err, errRestoreWindowPassed):
+		respondWithErr(w, http.StatusGone, "Chirp was deleted too long ago to restore", nil)
+		return
+	case err != nil:
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't restore chirp", err)
 		return
 	}
+	cfg.publishChirp(r.Context(), eventChirpRestored, c)
 
 	chirpRes := chirp{
 		Id:        c.ID,
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharath070/Chirpy/internal/auth"
+	"github.com/sharath070/Chirpy/internal/database"
+	"github.com/sharath070/Chirpy/internal/events"
+	"github.com/sharath070/Chirpy/internal/mailer"
+	"github.com/sharath070/Chirpy/internal/oidc"
+	"github.com/sharath070/Chirpy/internal/webhook"
+)
+
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("%s must be an integer, got %q", name, v)
+	}
+	return n
+}
+
+// envIntRange is envInt for values that get narrowed to a smaller type, so
+// they can't wrap around on the way.
+func envIntRange(name string, def, min, max int) int {
+	n := envInt(name, def)
+	if n < min || n > max {
+		log.Fatalf("%s must be between %d and %d, got %d", name, min, max, n)
+	}
+	return n
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("%s must be a duration like 30s, got %q", name, v)
+	}
+	return d
+}
+
+func envString(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// passwordHasherFromEnv lets the hashing cost be raised over time without a
+// code change. Existing hashes are upgraded on the user's next login.
+func passwordHasherFromEnv() auth.PasswordHasher {
+	h := auth.DefaultPasswordHasher
+
+	h.Algorithm = envString("PASSWORD_HASH_ALGO", h.Algorithm)
+	h.Argon2.Memory = uint32(envIntRange("ARGON2_MEMORY_KIB", int(h.Argon2.Memory), 1, math.MaxUint32))
+	h.Argon2.Iterations = uint32(envIntRange("ARGON2_ITERATIONS", int(h.Argon2.Iterations), 1, math.MaxUint32))
+	h.Argon2.Parallelism = uint8(envIntRange("ARGON2_PARALLELISM", int(h.Argon2.Parallelism), 1, math.MaxUint8))
+	h.BcryptCost = envInt("BCRYPT_COST", h.BcryptCost)
+
+	if h.Algorithm != auth.AlgorithmArgon2id && h.Algorithm != auth.AlgorithmBcrypt {
+		log.Fatalf("PASSWORD_HASH_ALGO must be %q or %q", auth.AlgorithmArgon2id, auth.AlgorithmBcrypt)
+	}
+	// argon2 panics on bad parameters, which would fail every signup and
+	// login rather than the startup
+	if err := h.Validate(); err != nil {
+		log.Fatal("password hashing settings: ", err)
+	}
+
+	return h
+}
+
+var trustProxy = os.Getenv("TRUST_PROXY") == "true"
+
+/*
+Token signing keys:
+
+	JWT_SIGNING_KEY_FILE  PEM private key (RSA or Ed25519) used to sign new tokens
+	JWT_SIGNING_KEY_ID    its kid, defaults to the key's RFC 7638 thumbprint
+	JWT_VERIFY_KEY_FILES  comma separated PEM keys (public or private) that are
+	                      still accepted but no longer sign, e.g. after a rotation
+	SECRET                HS256 secret; signs when no key file is set, and keeps
+	                      verifying tokens minted before we moved off it
+	JWT_ISSUER, JWT_AUDIENCE, JWT_LEEWAY
+	                      iss/aud we mint and require, and allowed clock skew
+*/
+func keyringFromEnv() *auth.Keyring {
+	var verifyOnly []auth.Key
+	for _, path := range strings.Split(os.Getenv("JWT_VERIFY_KEY_FILES"), ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		verifyOnly = append(verifyOnly, readKeyFile("", path))
+	}
+
+	var signing auth.Key
+	secret := os.Getenv("SECRET")
+	if path := os.Getenv("JWT_SIGNING_KEY_FILE"); path != "" {
+		signing = readKeyFile(os.Getenv("JWT_SIGNING_KEY_ID"), path)
+		if secret != "" {
+			verifyOnly = append(verifyOnly, auth.NewHMACKey("", []byte(secret)))
+		}
+	} else {
+		if secret == "" {
+			log.Fatal("either JWT_SIGNING_KEY_FILE or SECRET must be set")
+		}
+		signing = auth.NewHMACKey("", []byte(secret))
+	}
+
+	kr, err := auth.NewKeyring(signing, verifyOnly...)
+	if err != nil {
+		log.Fatal("Failed to build keyring: ", err)
+	}
+
+	kr.Tokens.Issuer = envString("JWT_ISSUER", kr.Tokens.Issuer)
+	kr.Tokens.Audience = envString("JWT_AUDIENCE", kr.Tokens.Audience)
+	kr.Tokens.Leeway = envDuration("JWT_LEEWAY", kr.Tokens.Leeway)
+	return kr
+}
+
+func readKeyFile(id, path string) auth.Key {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("read key %s: %v", path, err)
+	}
+
+	key, err := auth.ParseKeyPEM(id, data)
+	if err != nil {
+		log.Fatalf("parse key %s: %v", path, err)
+	}
+	return key
+}
+
+// mailerFromEnv picks SMTP when MAILER=smtp, otherwise mail is written to
+// MAIL_LOG_FILE (or stderr) so local signups can grab their links from it.
+func mailerFromEnv() mailer.Mailer {
+	from := envString("MAIL_FROM", "Chirpy <no-reply@chirpy.local>")
+
+	switch envString("MAILER", "log") {
+	case "smtp":
+		return mailer.SMTPMailer{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			From:     from,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	case "log":
+		path := os.Getenv("MAIL_LOG_FILE")
+		if path == "" {
+			return mailer.NewLogMailer(from, os.Stderr)
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			log.Fatalf("open MAIL_LOG_FILE: %v", err)
+		}
+		return mailer.NewLogMailer(from, f)
+	}
+
+	log.Fatal(`MAILER must be "smtp" or "log"`)
+	return nil
+}
+
+/*
+External sign-in, disabled unless OIDC_ISSUER is set:
+
+	OIDC_ISSUER         e.g. https://login.example.com; must match the
+	                    issuer in its discovery document exactly
+	OIDC_CLIENT_ID, OIDC_CLIENT_SECRET
+	OIDC_REDIRECT_URL   defaults to PUBLIC_URL + /api/auth/oidc/callback
+	OIDC_PROVIDER       name identities are stored under, defaults to "oidc"
+*/
+func oidcFromEnv(publicURL string) (*oidc.Client, string) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := oidc.NewClient(ctx, oidc.Config{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  envString("OIDC_REDIRECT_URL", publicURL+"/api/auth/oidc/callback"),
+		Scopes:       []string{"email", "profile"},
+	}, nil)
+	if err != nil {
+		log.Fatal("Failed to set up OIDC: ", err)
+	}
+	return client, envString("OIDC_PROVIDER", "oidc")
+}
+
+/*
+Database:
+
+	DB_URL                   postgres connection string
+	DB_MAX_OPEN_CONNS        pool size, default 25
+	DB_MAX_IDLE_CONNS        default 10
+	DB_CONN_MAX_LIFETIME     recycle connections after this, default 30m
+	DB_CONN_MAX_IDLE_TIME    close idle connections after this, default 5m
+	DB_CONNECT_TIMEOUT       how long startup keeps retrying, default 30s
+*/
+func openDBFromEnv() *sql.DB {
+	db, err := sql.Open("postgres", os.Getenv("DB_URL"))
+	if err != nil {
+		log.Fatal("DB connection failed: ", err)
+	}
+
+	db.SetMaxOpenConns(envInt("DB_MAX_OPEN_CONNS", 25))
+	db.SetMaxIdleConns(envInt("DB_MAX_IDLE_CONNS", 10))
+	db.SetConnMaxLifetime(envDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute))
+	db.SetConnMaxIdleTime(envDuration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute))
+
+	// sql.Open doesn't connect, so a bad DB_URL would otherwise only show
+	// up on the first request
+	ctx, cancel := context.WithTimeout(context.Background(), envDuration("DB_CONNECT_TIMEOUT", 30*time.Second))
+	defer cancel()
+	if err := pingWithRetry(ctx, db); err != nil {
+		log.Fatal("DB unreachable: ", err)
+	}
+
+	return db
+}
+
+// pingWithRetry pings until the database answers or ctx ends, backing off
+// from 500ms to 5s between attempts. Covers the database container still
+// starting when we do.
+func pingWithRetry(ctx context.Context, db *sql.DB) error {
+	delay := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		log.Printf("ping database (attempt %d): %v", attempt, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, 5*time.Second)
+	}
+}
+
+/*
+Admin:
+
+	ADMIN_USER_IDS   comma separated user ids allowed on /api/admin routes
+*/
+func adminsFromEnv() map[uuid.UUID]bool {
+	admins := map[uuid.UUID]bool{}
+	for _, s := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		id, err := uuid.Parse(s)
+		if err != nil {
+			log.Fatalf("Invalid user id %q in ADMIN_USER_IDS: %v", s, err)
+		}
+		admins[id] = true
+	}
+	return admins
+}
+
+/*
+Events:
+
+	EVENT_BUS   "memory" (default) for a single instance, or "postgres" to
+	            share events between instances over LISTEN/NOTIFY on DB_URL
+*/
+func eventBusFromEnv(db *sql.DB) events.Bus {
+	switch kind := envString("EVENT_BUS", "memory"); kind {
+	case "memory":
+		return events.NewMemoryBus()
+	case "postgres":
+		bus, err := events.NewPostgresBus(db, os.Getenv("DB_URL"), "chirpy_events")
+		if err != nil {
+			log.Fatal("Failed to set up event bus: ", err)
+		}
+		go bus.Run(context.Background())
+		return bus
+	default:
+		log.Fatalf("Unknown EVENT_BUS %q, want memory or postgres", kind)
+		return nil
+	}
+}
+
+/*
+Webhooks:
+
+	WEBHOOK_TIMEOUT         how long a receiver has to answer, default 10s
+	WEBHOOK_MAX_ATTEMPTS    tries per delivery, with backoff, default 8
+	WEBHOOK_DISABLE_AFTER   failed attempts in a row that turn a webhook
+	                        off, default 20
+	WEBHOOK_ALLOW_PRIVATE   "true" to allow receivers on loopback and private
+	                        addresses, e.g. tools inside the same network
+*/
+func webhookDispatcherFromEnv(queries *database.Queries) *webhook.Dispatcher {
+	sender := webhook.NewSender(envDuration("WEBHOOK_TIMEOUT", 10*time.Second), os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true")
+	d := webhook.NewDispatcher(queries, sender)
+	d.MaxAttempts = envInt("WEBHOOK_MAX_ATTEMPTS", d.MaxAttempts)
+	d.DisableAfter = envInt("WEBHOOK_DISABLE_AFTER", d.DisableAfter)
+	return d
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sharath070/Chirpy/internal/auth"
+)
+
+/*
+	Cookie session mode, for the /app/ frontend, so tokens never have to be
+	readable by JavaScript. Enabled with COOKIE_SESSIONS=true; clients opt in
+	per login with ?session=cookie on POST /api/login and /api/login/2fa.
+
+		chirpy_access   access JWT, HttpOnly, sent everywhere
+		chirpy_refresh  refresh token, HttpOnly, only sent to /api/refresh
+		chirpy_csrf     random value, readable by JS; state-changing requests
+		                authenticated by cookie must echo it in X-CSRF-Token
+		                (double-submit), which a cross-site form can't do
+
+	A request with an Authorization header is authenticated by that header
+	alone and never needs the CSRF token.
+*/
+
+const (
+	accessCookieName  = "chirpy_access"
+	refreshCookieName = "chirpy_refresh"
+	csrfCookieName    = "chirpy_csrf"
+	csrfHeaderName    = "X-CSRF-Token"
+
+	refreshCookiePath = "/api/refresh"
+	// matches the expiry CreateRefreshToken gives the row
+	refreshTokenTTL = 60 * 24 * time.Hour
+)
+
+// secureCookies is off only for plain-http local development, where the
+// browser would otherwise drop Secure cookies.
+func (cfg *apiConfig) secureCookies() bool {
+	return strings.HasPrefix(cfg.publicURL, "https://")
+}
+
+func (cfg *apiConfig) wantsCookieSession(r *http.Request) bool {
+	return cfg.cookieSessions && r.URL.Query().Get("session") == "cookie"
+}
+
+func (cfg *apiConfig) sessionCookie(name, value, path string, maxAge time.Duration, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: httpOnly,
+		Secure:   cfg.secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// setSessionCookies hands a new session to the browser, with a fresh CSRF
+// token so one from a previous login can't be reused.
+func (cfg *apiConfig) setSessionCookies(w http.ResponseWriter, accessToken, refreshToken string) error {
+	csrf, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	cfg.setAccessCookie(w, accessToken)
+	http.SetCookie(w, cfg.sessionCookie(refreshCookieName, refreshToken, refreshCookiePath, refreshTokenTTL, true))
+	http.SetCookie(w, cfg.sessionCookie(csrfCookieName, csrf, "/", refreshTokenTTL, false))
+	return nil
+}
+
+func (cfg *apiConfig) setAccessCookie(w http.ResponseWriter, accessToken string) {
+	http.SetCookie(w, cfg.sessionCookie(accessCookieName, accessToken, "/", time.Hour, true))
+}
+
+func (cfg *apiConfig) clearSessionCookies(w http.ResponseWriter) {
+	// a negative duration becomes MaxAge<0, i.e. delete now
+	http.SetCookie(w, cfg.sessionCookie(accessCookieName, "", "/", -time.Second, true))
+	http.SetCookie(w, cfg.sessionCookie(refreshCookieName, "", refreshCookiePath, -time.Second, true))
+	http.SetCookie(w, cfg.sessionCookie(csrfCookieName, "", "/", -time.Second, false))
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// checkCSRF is the double-submit check: the header must match the cookie.
+func checkCSRF(r *http.Request) bool {
+	c, err := r.Cookie(csrfCookieName)
+	if err != nil || c.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(c.Value), []byte(r.Header.Get(csrfHeaderName))) == 1
+}
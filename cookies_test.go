@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharath070/Chirpy/internal/auth"
+	"github.com/sharath070/Chirpy/internal/database"
+)
+
+// refreshRowsDriver answers UseRefreshToken with refreshRow when the token
+// hash matches refreshHash, and with no rows otherwise.
+type refreshRowsDriver struct{}
+
+var (
+	refreshHash string
+	refreshRow  []driver.Value
+)
+
+func (refreshRowsDriver) Open(string) (driver.Conn, error) { return refreshRowsConn{}, nil }
+
+type refreshRowsConn struct{}
+
+func (refreshRowsConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (refreshRowsConn) Close() error                        { return nil }
+func (refreshRowsConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (refreshRowsConn) QueryContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) == 0 || args[0].Value != refreshHash {
+		return &fakeRows{}, nil
+	}
+	return &fakeRows{rows: [][]driver.Value{refreshRow}}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (*fakeRows) Columns() []string { return []string{"id", "user_id"} }
+func (*fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("refresh-rows", refreshRowsDriver{})
+}
+
+func newCookieTestConfig(t *testing.T) *apiConfig {
+	t.Helper()
+	kr, err := auth.NewKeyring(auth.NewHMACKey("", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &apiConfig{
+		keyring:        kr,
+		revocations:    auth.NewRevocationList(accessTokenTTL),
+		cookieSessions: true,
+		publicURL:      "https://chirpy.example.com",
+	}
+}
+
+func TestMiddlewareAuthCSRF(t *testing.T) {
+	cfg := newCookieTestConfig(t)
+	token, err := cfg.keyring.MakeAccessToken(auth.Principal{UserID: uuid.New(), SessionID: uuid.New()}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const csrf = "csrf-token"
+
+	tests := []struct {
+		name           string
+		method         string
+		bearer         bool
+		accessCookie   bool
+		csrfCookie     string
+		csrfHeader     string
+		cookieSessions bool
+		wantCode       int
+	}{
+		{
+			name:           "Cookie POST without CSRF header",
+			method:         http.MethodPost,
+			accessCookie:   true,
+			csrfCookie:     csrf,
+			cookieSessions: true,
+			wantCode:       http.StatusForbidden,
+		},
+		{
+			name:           "Cookie POST with mismatched CSRF token",
+			method:         http.MethodPost,
+			accessCookie:   true,
+			csrfCookie:     csrf,
+			csrfHeader:     "something-else",
+			cookieSessions: true,
+			wantCode:       http.StatusForbidden,
+		},
+		{
+			name:           "Cookie POST with CSRF header but no CSRF cookie",
+			method:         http.MethodPost,
+			accessCookie:   true,
+			csrfHeader:     csrf,
+			cookieSessions: true,
+			wantCode:       http.StatusForbidden,
+		},
+		{
+			name:           "Cookie DELETE with matching CSRF token",
+			method:         http.MethodDelete,
+			accessCookie:   true,
+			csrfCookie:     csrf,
+			csrfHeader:     csrf,
+			cookieSessions: true,
+			wantCode:       http.StatusOK,
+		},
+		{
+			name:           "Cookie GET needs no CSRF token",
+			method:         http.MethodGet,
+			accessCookie:   true,
+			cookieSessions: true,
+			wantCode:       http.StatusOK,
+		},
+		{
+			name:           "Bearer POST needs no CSRF token",
+			method:         http.MethodPost,
+			bearer:         true,
+			cookieSessions: true,
+			wantCode:       http.StatusOK,
+		},
+		{
+			name:         "Cookie ignored without cookie sessions",
+			method:       http.MethodGet,
+			accessCookie: true,
+			wantCode:     http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.cookieSessions = tt.cookieSessions
+
+			r := httptest.NewRequest(tt.method, "/api/chirps", nil)
+			if tt.bearer {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+			if tt.accessCookie {
+				r.AddCookie(&http.Cookie{Name: accessCookieName, Value: token})
+			}
+			if tt.csrfCookie != "" {
+				r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: tt.csrfCookie})
+			}
+			if tt.csrfHeader != "" {
+				r.Header.Set(csrfHeaderName, tt.csrfHeader)
+			}
+
+			w := httptest.NewRecorder()
+			cfg.middlewareAuth(true, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				principal(r)
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d (%s)", w.Code, tt.wantCode, w.Body)
+			}
+		})
+	}
+}
+
+func TestHandleRefreshFromCookie(t *testing.T) {
+	db, err := sql.Open("refresh-rows", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cfg := newCookieTestConfig(t)
+	cfg.dbQueries = database.New(db)
+
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID, userID := uuid.New(), uuid.New()
+	refreshHash = auth.HashRefreshToken(refreshToken)
+	refreshRow = []driver.Value{sessionID.String(), userID.String()}
+	const csrf = "csrf-token"
+
+	tests := []struct {
+		name       string
+		token      string
+		csrfHeader string
+		wantCode   int
+	}{
+		{name: "With CSRF token", token: refreshToken, csrfHeader: csrf, wantCode: http.StatusNoContent},
+		{name: "Without CSRF token", token: refreshToken, wantCode: http.StatusForbidden},
+		{name: "Mismatched CSRF token", token: refreshToken, csrfHeader: "something-else", wantCode: http.StatusForbidden},
+		{name: "Unknown refresh token", token: "not-a-session", csrfHeader: csrf, wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+			r.AddCookie(&http.Cookie{Name: refreshCookieName, Value: tt.token})
+			r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: csrf})
+			if tt.csrfHeader != "" {
+				r.Header.Set(csrfHeaderName, tt.csrfHeader)
+			}
+
+			w := httptest.NewRecorder()
+			cfg.handleRefresh(w, r)
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d (%s)", w.Code, tt.wantCode, w.Body)
+			}
+			if w.Code != http.StatusNoContent {
+				return
+			}
+
+			var access *http.Cookie
+			for _, c := range w.Result().Cookies() {
+				if c.Name == accessCookieName {
+					access = c
+				}
+			}
+			if access == nil {
+				t.Fatal("no access cookie set")
+			}
+			p, err := cfg.keyring.ParseAccessToken(access.Value)
+			if err != nil {
+				t.Fatalf("ParseAccessToken(cookie) err = %v", err)
+			}
+			if p.UserID != userID || p.SessionID != sessionID {
+				t.Errorf("access cookie principal = %+v, want user %v session %v", p, userID, sessionID)
+			}
+		})
+	}
+}
+
+func TestSessionCookiesSecure(t *testing.T) {
+	tests := []struct {
+		publicURL  string
+		wantSecure bool
+	}{
+		{publicURL: "https://chirpy.example.com", wantSecure: true},
+		{publicURL: "http://localhost:8080", wantSecure: false},
+		{publicURL: "", wantSecure: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.publicURL, func(t *testing.T) {
+			cfg := &apiConfig{publicURL: tt.publicURL}
+
+			w := httptest.NewRecorder()
+			if err := cfg.setSessionCookies(w, "access", "refresh"); err != nil {
+				t.Fatal(err)
+			}
+
+			cookies := w.Result().Cookies()
+			if len(cookies) != 3 {
+				t.Fatalf("got %d cookies, want 3", len(cookies))
+			}
+			for _, c := range cookies {
+				if c.Secure != tt.wantSecure {
+					t.Errorf("%s Secure = %v, want %v", c.Name, c.Secure, tt.wantSecure)
+				}
+				if wantHTTPOnly := c.Name != csrfCookieName; c.HttpOnly != wantHTTPOnly {
+					t.Errorf("%s HttpOnly = %v, want %v", c.Name, c.HttpOnly, wantHTTPOnly)
+				}
+				if c.Name == refreshCookieName && c.Path != refreshCookiePath {
+					t.Errorf("%s Path = %q, want %q", c.Name, c.Path, refreshCookiePath)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharath070/Chirpy/internal/database"
+	"github.com/sharath070/Chirpy/internal/events"
+)
+
+// Domain event types on cfg.events.
+const (
+	eventChirpCreated        = "chirp.created"
+	eventChirpDeleted        = "chirp.deleted"
+	eventChirpRestored       = "chirp.restored"
+	eventUserCreated         = "user.created"
+	eventUserUpdated         = "user.updated"
+	eventSessionsRevoked     = "sessions.revoked"
+	eventNotificationCreated = "notification.created"
+)
+
+// publishTimeout bounds a publish; with the Postgres bus it's a round trip.
+const publishTimeout = 5 * time.Second
+
+type userEvent struct {
+	Id    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+}
+
+// sessionsRevokedEvent is one session revoked, or with SessionID unset all
+// of the user's except Except.
+type sessionsRevokedEvent struct {
+	UserID    uuid.UUID  `json:"user_id"`
+	SessionID *uuid.UUID `json:"session_id,omitempty"`
+	Except    *uuid.UUID `json:"except,omitempty"`
+	At        time.Time  `json:"at"`
+}
+
+// publish announces an event and queues it for webhooks. The write it
+// describes has already happened, so a failure is logged rather than
+// failing the request, and a client hanging up doesn't stop it.
+func (cfg *apiConfig) publish(ctx context.Context, typ string, data any) {
+	e, err := events.New(typ, data)
+	if err != nil {
+		log.Printf("build %s event: %v", typ, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), publishTimeout)
+	defer cancel()
+	if err := cfg.events.Publish(ctx, e); err != nil {
+		log.Printf("publish %s event: %v", typ, err)
+	}
+	// here rather than in a bus subscriber, which with EVENT_BUS=postgres
+	// would run on every instance and deliver each event several times
+	if err := cfg.queueWebhooks(ctx, e); err != nil {
+		log.Printf("queue webhooks for %s event: %v", typ, err)
+	}
+}
+
+func (cfg *apiConfig) publishChirp(ctx context.Context, typ string, c database.Chirp) {
+	cfg.publish(ctx, typ, chirp{
+		Id:        c.ID,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+		Body:      c.Body,
+		UserId:    c.UserID,
+		DeletedAt: nullTimePtr(c.DeletedAt),
+	})
+}
+
+func (cfg *apiConfig) publishUser(ctx context.Context, typ string, u database.User) {
+	cfg.publish(ctx, typ, userEvent{Id: u.ID, Email: u.Email})
+}
+
+func (cfg *apiConfig) publishSessionRevoked(ctx context.Context, userID, sessionID uuid.UUID) {
+	cfg.publish(ctx, eventSessionsRevoked, sessionsRevokedEvent{
+		UserID:    userID,
+		SessionID: &sessionID,
+		At:        time.Now(),
+	})
+}
+
+// publishAllSessionsRevoked is for all of userID's sessions but except
+// (uuid.Nil for none).
+func (cfg *apiConfig) publishAllSessionsRevoked(ctx context.Context, userID, except uuid.UUID) {
+	e := sessionsRevokedEvent{UserID: userID, At: time.Now()}
+	if except != uuid.Nil {
+		e.Except = &except
+	}
+	cfg.publish(ctx, eventSessionsRevoked, e)
+}
+
+// subscribeEvents wires the event consumers of this instance.
+func (cfg *apiConfig) subscribeEvents() {
+	cfg.events.Subscribe(cfg.streamChirpEvent, eventChirpCreated, eventChirpDeleted, eventChirpRestored)
+	cfg.events.Subscribe(cfg.applySessionRevocation, eventSessionsRevoked)
+	cfg.events.Subscribe(cfg.streamNotification, eventNotificationCreated)
+
+	// revocations must not be missed: pick up those made before this
+	// instance started, and those made while the bus was disconnected
+	go cfg.loadRevocations()
+	if pg, ok := cfg.events.(*events.PostgresBus); ok {
+		pg.OnReconnect(cfg.loadRevocations)
+	}
+}
+
+// streamChirpEvent forwards chirp events to the SSE hub, under topics for
+// the stream's filters.
+func (cfg *apiConfig) streamChirpEvent(e events.Event) {
+	var c chirp
+	if err := json.Unmarshal(e.Data, &c); err != nil {
+		log.Printf("decode %s event: %v", e.Type, err)
+		return
+	}
+
+	topics := []string{"author:" + c.UserId.String()}
+	for _, tag := range hashtags(c.Body) {
+		topics = append(topics, "hashtag:"+tag)
+	}
+	cfg.chirpHub.Publish(strings.TrimPrefix(e.Type, "chirp."), e.Data, topics...)
+}
+
+// streamNotification hands a new notification to its recipient's open
+// WebSockets on this instance.
+func (cfg *apiConfig) streamNotification(e events.Event) {
+	var n notification
+	if err := json.Unmarshal(e.Data, &n); err != nil {
+		log.Printf("decode %s event: %v", e.Type, err)
+		return
+	}
+	cfg.notificationHub.Publish("notification", e.Data, "user:"+n.UserId.String())
+}
+
+// applySessionRevocation makes revoked sessions' access tokens stop working
+// on this instance right away, rather than when they expire.
+func (cfg *apiConfig) applySessionRevocation(e events.Event) {
+	var ev sessionsRevokedEvent
+	if err := json.Unmarshal(e.Data, &ev); err != nil {
+		log.Printf("decode %s event: %v", e.Type, err)
+		return
+	}
+
+	if ev.SessionID != nil {
+		cfg.revocations.RevokeSession(*ev.SessionID)
+		return
+	}
+	except := uuid.Nil
+	if ev.Except != nil {
+		except = *ev.Except
+	}
+	cfg.revocations.RevokeUser(ev.UserID, ev.At, except)
+}
+
+// loadRevocations fills the revocation list from the database with every
+// session revoked recently enough for its access tokens to still work.
+func (cfg *apiConfig) loadRevocations() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	since := sql.NullTime{Time: time.Now().Add(-accessTokenTTL), Valid: true}
+	ids, err := cfg.dbQueries.ListRevokedSessionIDs(ctx, since)
+	if err != nil {
+		log.Printf("load revoked sessions: %v", err)
+		return
+	}
+	for _, id := range ids {
+		cfg.revocations.RevokeSession(id)
+	}
+}
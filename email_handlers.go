@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharath070/Chirpy/internal/auth"
+	"github.com/sharath070/Chirpy/internal/database"
+	"github.com/sharath070/Chirpy/internal/mailer"
+	"github.com/sharath070/Chirpy/internal/validate"
+)
+
+const (
+	tokenPurposeVerifyEmail   = "verify_email"
+	tokenPurposeResetPassword = "reset_password"
+
+	verifyEmailTTL   = 24 * time.Hour
+	resetPasswordTTL = time.Hour
+	mailSendTimeout  = 30 * time.Second
+)
+
+// createUserToken stores the hash of a fresh single-use token and returns
+// the plaintext to put in the email. Older unused tokens for the same purpose
+// are invalidated so only the latest link works.
+func (cfg *apiConfig) createUserToken(ctx context.Context, user database.User, purpose string, ttl time.Duration) (string, error) {
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	if err := cfg.storeUserToken(ctx, user, purpose, token, ttl); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// storeUserToken is createUserToken for a token made elsewhere.
+func (cfg *apiConfig) storeUserToken(ctx context.Context, user database.User, purpose, token string, ttl time.Duration) error {
+	return cfg.tx.InTx(ctx, func(q *database.Queries) error {
+		err := q.InvalidateUserTokens(ctx, database.InvalidateUserTokensParams{
+			UserID:  user.ID,
+			Purpose: purpose,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = q.CreateUserToken(ctx, database.CreateUserTokenParams{
+			ExpiresAt: time.Now().Add(ttl),
+			TokenHash: auth.HashOpaqueToken(token),
+			Purpose:   purpose,
+			UserID:    user.ID,
+			Email:     user.Email,
+		})
+		return err
+	})
+}
+
+// sendMail delivers in the background so slow SMTP servers don't hold up the
+// request, and so response times don't reveal whether an address exists.
+func (cfg *apiConfig) sendMail(msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+
+		if err := cfg.mailer.Send(ctx, msg); err != nil {
+			log.Printf("send %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
+
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, user database.User) error {
+	token, err := cfg.createUserToken(ctx, user, tokenPurposeVerifyEmail, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	cfg.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Confirm this is your address by opening the link below:\n\n%s/app/account/verify.html?token=%s\n\n"+
+			"The link expires in %s. If you didn't sign up for Chirpy you can ignore this email.\n",
+			cfg.publicURL, token, verifyEmailTTL),
+	})
+	return nil
+}
+
+var errInvalidUserToken = errors.New("invalid or expired token")
+
+type userTokenParams struct {
+	Token string `json:"token" validate:"required"`
+}
+
+func (cfg *apiConfig) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeJSON[userTokenParams](w, r)
+	if err != nil {
+		respondWithDecodeErr(w, err)
+		return
+	}
+
+	err = cfg.tx.InTx(r.Context(), func(q *database.Queries) error {
+		token, err := q.UseUserToken(r.Context(), database.UseUserTokenParams{
+			TokenHash: auth.HashOpaqueToken(params.Token),
+			Purpose:   tokenPurposeVerifyEmail,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return errInvalidUserToken
+		}
+		if err != nil {
+			return err
+		}
+
+		// matching on the email too means a link sent to an old address can't
+		// verify whatever the account was changed to since
+		n, err := q.MarkEmailVerified(r.Context(), database.MarkEmailVerifiedParams{
+			ID:    token.UserID,
+			Email: token.Email,
+		})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errInvalidUserToken
+		}
+		return nil
+	})
+	if errors.Is(err, errInvalidUserToken) {
+		respondWithErr(w, http.StatusBadRequest, "Invalid or expired token", nil)
+		return
+	}
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleResendVerification sends the caller a fresh verification link, for
+// when the first one got lost or expired. Earlier links stop working.
+func (cfg *apiConfig) handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), principal(r).UserID)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't look up user", err)
+		return
+	}
+	if user.EmailVerifiedAt.Valid {
+		respondWithErr(w, http.StatusConflict, "Email is already verified", nil)
+		return
+	}
+
+	if err := cfg.sendVerificationEmail(r.Context(), user); err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't send verification email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type forgotPasswordParams struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// handleForgotPassword always answers 202 so it can't be used to find out
+// which addresses have accounts. Both cases do the same lookup and nothing
+// more on the request path; the reset link is made in the background so the
+// response time doesn't tell them apart either.
+func (cfg *apiConfig) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeJSON[forgotPasswordParams](w, r)
+	if err != nil {
+		respondWithDecodeErr(w, err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByEmail(r.Context(), params.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't start password reset", err)
+		return
+	}
+
+	go cfg.sendPasswordResetEmail(user)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (cfg *apiConfig) sendPasswordResetEmail(user database.User) {
+	ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+	defer cancel()
+
+	token, err := cfg.createUserToken(ctx, user, tokenPurposeResetPassword, resetPasswordTTL)
+	if err != nil {
+		log.Printf("password reset for %s: %v", user.ID, err)
+		return
+	}
+
+	cfg.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for this account. Choose a new one here:\n\n%s/app/account/reset-password.html?token=%s\n\n"+
+			"The link expires in %s and can only be used once. If it wasn't you, you can ignore this email.\n",
+			cfg.publicURL, token, resetPasswordTTL),
+	})
+}
+
+type resetPasswordParams struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+func (cfg *apiConfig) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeJSON[resetPasswordParams](w, r)
+	if err != nil {
+		respondWithDecodeErr(w, err)
+		return
+	}
+
+	// only peek at the token here; it's consumed once the new password has
+	// passed the policy, so a rejected password doesn't burn the link
+	token, err := cfg.dbQueries.GetValidUserToken(r.Context(), database.GetValidUserTokenParams{
+		TokenHash: auth.HashOpaqueToken(params.Token),
+		Purpose:   tokenPurposeResetPassword,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithErr(w, http.StatusBadRequest, "Invalid or expired token", err)
+		return
+	}
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), token.UserID)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	if err := cfg.passwordPolicy.Check(params.Password, user.Email); err != nil {
+		respondWithDecodeErr(w, validate.Errors{{Field: "password", Message: err.Error()}})
+		return
+	}
+
+	hash, err := cfg.passwordHasher.Hash(params.Password)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Failed to generate the hash password", err)
+		return
+	}
+
+	err = cfg.tx.InTx(r.Context(), func(q *database.Queries) error {
+		_, err := q.UseUserToken(r.Context(), database.UseUserTokenParams{
+			TokenHash: token.TokenHash,
+			Purpose:   tokenPurposeResetPassword,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			// used by a concurrent request in the meantime
+			return errInvalidUserToken
+		}
+		if err != nil {
+			return err
+		}
+
+		err = q.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+			ID:             user.ID,
+			HashedPassword: hash,
+		})
+		if err != nil {
+			return err
+		}
+
+		// whoever knew the old password may still be logged in somewhere,
+		// or have made a token or authorized an app to act for them. The
+		// second factor stays: it's what the reset link alone can't get past.
+		if err := q.RevokeAllSessions(r.Context(), user.ID); err != nil {
+			return err
+		}
+		return q.RevokeIssuedTokens(r.Context(), user.ID)
+	})
+	if errors.Is(err, errInvalidUserToken) {
+		respondWithErr(w, http.StatusBadRequest, "Invalid or expired token", nil)
+		return
+	}
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+	cfg.publishAllSessionsRevoked(r.Context(), user.ID, uuid.Nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
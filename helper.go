@@ -1,13 +1,47 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sharath070/Chirpy/internal/auth"
+	"github.com/sharath070/Chirpy/internal/database"
+	"github.com/sharath070/Chirpy/internal/validate"
 )
 
+// maxBodyBytes caps every JSON request body. Chirps are 140 chars, so 1MB is
+// plenty of headroom while still stopping someone from streaming gigabytes.
+const maxBodyBytes = 1 << 20
+
 func respondWithErr(w http.ResponseWriter, code int, msg string, err error) {
-	log.Println(err)
+	if err != nil {
+		log.Println(err)
+	}
+
+	// whatever the handler thought went wrong, a query that ran out of time
+	// isn't a 400 or a 500
+	switch {
+	case errors.Is(err, database.ErrQueryTimeout):
+		code, msg = http.StatusServiceUnavailable, "The database is busy, try again shortly"
+		setRetryAfter(w, time.Second)
+	case errors.Is(err, context.DeadlineExceeded) || isQueryCanceled(err):
+		code, msg = http.StatusGatewayTimeout, "Request timed out"
+	case errors.Is(err, context.Canceled):
+		// the client went away; nobody reads this
+		code, msg = http.StatusServiceUnavailable, "Request cancelled"
+	}
 
 	if code >= 500 {
 		log.Printf("Responding with 5XX error: %s\n", msg)
@@ -21,14 +55,166 @@ func respondWithErr(w http.ResponseWriter, code int, msg string, err error) {
 }
 
 func respondWithJson(w http.ResponseWriter, code int, payload any) {
-	w.Header().Add("Content-Type", "application/json")
-
-	err := json.NewEncoder(w).Encode(payload)
+	data, err := json.Marshal(payload)
 	if err != nil {
 		log.Println("Error Marshalling JSON:", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	// headers and status have to go out before the body, otherwise
+	// net/http has already sent a 200
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
+	w.Write(data)
+	w.Write([]byte("\n"))
+}
+
+// decodeJSON reads a single JSON object from the request body into T,
+// rejecting oversized bodies, unknown fields and trailing data, and then runs
+// the `validate` tags on the result.
+func decodeJSON[T any](w http.ResponseWriter, r *http.Request) (T, error) {
+	var params T
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&params); err != nil {
+		return params, err
+	}
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return params, errors.New("request body must contain a single JSON object")
+	}
+
+	if err := validate.Struct(&params); err != nil {
+		return params, err
+	}
+
+	return params, nil
+}
+
+// respondWithDecodeErr turns an error from decodeJSON into the right status:
+// 413 for oversized bodies, 422 with per-field details for validation
+// failures and 400 for anything that isn't valid JSON for the target type.
+func respondWithDecodeErr(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		respondWithErr(w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("request body must not exceed %d bytes", maxBytesErr.Limit), err)
+		return
+	}
+
+	var fieldErrs validate.Errors
+	if errors.As(err, &fieldErrs) {
+		log.Println(err)
+		respondWithJson(w, http.StatusUnprocessableEntity, struct {
+			Error  string                `json:"error"`
+			Fields []validate.FieldError `json:"fields"`
+		}{
+			Error:  "validation failed",
+			Fields: fieldErrs,
+		})
+		return
+	}
+
+	respondWithErr(w, http.StatusBadRequest, "invalid request body", err)
+}
+
+// clientIP is the address the request came from. X-Forwarded-For is only
+// honoured when TRUST_PROXY=true, otherwise any client could pick their own IP.
+func clientIP(r *http.Request) string {
+	if trustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			first, _, _ := strings.Cut(fwd, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// setRetryAfter sets the Retry-After header in whole seconds, rounding up.
+// A zero wait leaves the header alone.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	if wait <= 0 {
+		return
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+// respondWithAuthErr answers a failed bearer token check with 401 and an RFC
+// 6750 WWW-Authenticate challenge. A missing token gets a bare challenge,
+// a bad one says why, so clients know whether refreshing will help.
+func respondWithAuthErr(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		// personal access token or OAuth grant that doesn't exist, expired
+		// or was revoked
+		err = fmt.Errorf("%w: %w", auth.ErrTokenBadSignature, err)
+	}
+
+	challenge := `Bearer realm="chirpy"`
+
+	desc := ""
+	switch {
+	case errors.Is(err, auth.ErrTokenExpired):
+		desc = "the access token expired"
+	case errors.Is(err, auth.ErrTokenNotYetValid):
+		desc = "the access token is not valid yet"
+	case errors.Is(err, auth.ErrTokenWrongAudience):
+		desc = "the access token is for a different audience"
+	case errors.Is(err, auth.ErrTokenRevoked):
+		desc = "the access token was revoked"
+	case errors.Is(err, auth.ErrTokenWrongIssuer):
+		desc = "the access token was issued by someone else"
+	case errors.Is(err, auth.ErrTokenBadSignature):
+		desc = "the access token signature is invalid"
+	case errors.Is(err, auth.ErrTokenMalformed):
+		desc = "the access token is malformed"
+	}
+	if desc != "" {
+		challenge += fmt.Sprintf(`, error="invalid_token", error_description=%q`, desc)
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+	if desc == "" {
+		desc = "authentication required"
+	}
+	respondWithErr(w, http.StatusUnauthorized, desc, err)
+}
+
+// principal returns the caller set by middlewareAuth. Only call it from
+// handlers registered behind requireAuth.
+func principal(r *http.Request) auth.Principal {
+	p, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		panic("principal() called on a route without requireAuth")
+	}
+	return p
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// respondWithScopeErr is the RFC 6750 answer for a valid token that isn't
+// allowed to do this.
+func respondWithScopeErr(w http.ResponseWriter, scope string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="chirpy", error="insufficient_scope", scope=%q`, scope))
+	respondWithErr(w, http.StatusForbidden, "token is missing scope "+scope, nil)
+}
+
+// isQueryCanceled catches a timeout that surfaced from Postgres itself
+// (query_canceled) instead of as a context error, which happens when the
+// context ends while lib/pq is waiting on the server.
+func isQueryCanceled(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "57014"
 }
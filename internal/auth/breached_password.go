@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+/*
+	The list is stored the same way the Pwned Passwords API serves it: SHA-1 of
+	the password, bucketed by the first 5 hex characters (the "range"), and
+	within a bucket by the remaining 35 (the "suffix"). Lookups only ever need
+	the bucket for one prefix, so an online checker can implement the same
+	interface by fetching https://api.pwnedpasswords.com/range/{prefix} without
+	sending the full hash anywhere.
+*/
+
+type BreachedPasswordChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+//go:embed breached_passwords.txt
+var bundledBreachedPasswords string
+
+var (
+	bundledOnce sync.Once
+	bundledList *BreachedPasswordList
+)
+
+// BundledBreachedPasswords returns the list shipped with the binary. It is
+// parsed once on first use.
+func BundledBreachedPasswords() *BreachedPasswordList {
+	bundledOnce.Do(func() {
+		l, err := LoadBreachedPasswords(strings.NewReader(bundledBreachedPasswords))
+		if err != nil {
+			panic("auth: bundled breached password list is corrupt: " + err.Error())
+		}
+		bundledList = l
+	})
+	return bundledList
+}
+
+type BreachedPasswordList struct {
+	ranges map[string]map[string]struct{}
+}
+
+// LoadBreachedPasswords reads one uppercase or lowercase hex SHA-1 per line.
+// Blank lines and lines starting with # are skipped.
+func LoadBreachedPasswords(r io.Reader) (*BreachedPasswordList, error) {
+	l := &BreachedPasswordList{ranges: map[string]map[string]struct{}{}}
+
+	sc := bufio.NewScanner(r)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// tolerate the API's "SUFFIX:COUNT" style by ignoring the count
+		hash, _, _ := strings.Cut(line, ":")
+		hash = strings.ToUpper(hash)
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("line %d: expected %d hex characters", lineNo, sha1.Size*2)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		l.add(hash)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *BreachedPasswordList) add(hash string) {
+	prefix, suffix := hash[:5], hash[5:]
+	bucket, ok := l.ranges[prefix]
+	if !ok {
+		bucket = map[string]struct{}{}
+		l.ranges[prefix] = bucket
+	}
+	bucket[suffix] = struct{}{}
+}
+
+func (l *BreachedPasswordList) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	_, found := l.ranges[hash[:5]][hash[5:]]
+	return found, nil
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -10,6 +11,37 @@ import (
 	"github.com/google/uuid"
 )
 
+// Typed validation errors so handlers can tell the client exactly what was
+// wrong via WWW-Authenticate, without depending on the jwt library.
+var (
+	ErrTokenMalformed     = errors.New("token is malformed")
+	ErrTokenBadSignature  = errors.New("token signature is invalid")
+	ErrTokenExpired       = errors.New("token has expired")
+	ErrTokenNotYetValid   = errors.New("token is not valid yet")
+	ErrTokenWrongIssuer   = errors.New("token has the wrong issuer")
+	ErrTokenWrongAudience = errors.New("token has the wrong audience")
+	ErrTokenRevoked       = errors.New("token has been revoked")
+)
+
+func classifyTokenError(err error) error {
+	var typed error
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		typed = ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		typed = ErrTokenNotYetValid
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		typed = ErrTokenWrongIssuer
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		typed = ErrTokenWrongAudience
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		typed = ErrTokenBadSignature
+	default:
+		typed = ErrTokenMalformed
+	}
+	return fmt.Errorf("%w: %w", typed, err)
+}
+
 /*
 	"Claims" in JWT = Data embedded in the token
 
@@ -17,20 +49,14 @@ import (
 	JWT has a set of registered (standard) fields defined in the spec (RFC 7519) that help describe the token's purpose, origin, and validity.
 */
 
+// MakeJWT signs with a single HS256 secret. Prefer Keyring.MakeJWT, this is
+// kept for callers that only have the shared SECRET.
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn).UTC()),
-		Subject:   userID.String(),
-	})
-
-	tokenStr, err := token.SignedString([]byte(tokenSecret))
+	kr, err := NewKeyring(NewHMACKey("", []byte(tokenSecret)))
 	if err != nil {
 		return "", err
 	}
-
-	return tokenStr, nil
+	return kr.MakeJWT(userID, expiresIn)
 }
 
 /*
@@ -52,30 +78,11 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 */
 
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := jwt.RegisteredClaims{}
-	/*
-		we are passing `&claims` ptr to claims cuz both
-		jwt.RegisteredClaims{} and it's ptr implements interface jwt.Claims
-		and ptr to claims allows for its modification
-	*/
-	tkn, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (any, error) {
-		return []byte(tokenSecret), nil
-	})
-	if err != nil {
-		return uuid.Nil, err
-	}
-
-	userId, err := tkn.Claims.GetSubject()
-	if err != nil {
-		return uuid.Nil, err
-	}
-
-	id, err := uuid.Parse(userId)
+	kr, err := NewKeyring(NewHMACKey("", []byte(tokenSecret)))
 	if err != nil {
 		return uuid.Nil, err
 	}
-
-	return id, nil
+	return kr.ValidateJWT(tokenString)
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -0,0 +1,375 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+/*
+	A Keyring holds one key used to sign new tokens and any number of keys that
+	are only used to verify. Rotation goes:
+
+		1. add the new key as verify-only everywhere (JWKS now publishes it)
+		2. make it the signing key, keep the old one as verify-only
+		3. once the old tokens have expired (access tokens live an hour), drop it
+
+	Every token carries the `kid` of the key that signed it so the verifier,
+	ours or another service reading /.well-known/jwks.json, knows which key to
+	use. HMAC keys can live in the same ring so tokens signed with the old
+	SECRET keep working while we move to asymmetric keys, but they're never
+	published.
+*/
+
+var (
+	ErrUnknownKeyID      = errors.New("unknown signing key id")
+	ErrUnsupportedKey    = errors.New("unsupported key type")
+	ErrAlgorithmMismatch = errors.New("token algorithm does not match key")
+)
+
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// nil for verify-only keys
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+func NewHMACKey(id string, secret []byte) Key {
+	return Key{ID: id, Method: jwt.SigningMethodHS256, private: secret, public: secret}
+}
+
+// NewKeyFromPrivate wraps an *rsa.PrivateKey (RS256) or ed25519.PrivateKey
+// (EdDSA). An empty id is replaced with the RFC 7638 thumbprint of the key.
+func NewKeyFromPrivate(id string, priv crypto.PrivateKey) (Key, error) {
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		return newPublicKey(id, jwt.SigningMethodRS256, k, &k.PublicKey)
+	case ed25519.PrivateKey:
+		return newPublicKey(id, jwt.SigningMethodEdDSA, k, k.Public())
+	}
+	return Key{}, fmt.Errorf("%w: %T", ErrUnsupportedKey, priv)
+}
+
+// NewKeyFromPublic creates a verify-only key.
+func NewKeyFromPublic(id string, pub crypto.PublicKey) (Key, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return newPublicKey(id, jwt.SigningMethodRS256, nil, k)
+	case ed25519.PublicKey:
+		return newPublicKey(id, jwt.SigningMethodEdDSA, nil, k)
+	}
+	return Key{}, fmt.Errorf("%w: %T", ErrUnsupportedKey, pub)
+}
+
+func newPublicKey(id string, method jwt.SigningMethod, priv crypto.PrivateKey, pub crypto.PublicKey) (Key, error) {
+	k := Key{ID: id, Method: method, private: priv, public: pub}
+	if k.ID == "" {
+		k.ID = k.JWK().Thumbprint()
+	}
+	return k, nil
+}
+
+// ParseKeyPEM reads a PKCS#8 / PKCS#1 private key or a PKIX public key.
+func ParseKeyPEM(id string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		return NewKeyFromPrivate(id, priv)
+	case "RSA PRIVATE KEY":
+		priv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		return NewKeyFromPrivate(id, priv)
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		return NewKeyFromPublic(id, pub)
+	}
+
+	return Key{}, fmt.Errorf("%w: PEM block %q", ErrUnsupportedKey, block.Type)
+}
+
+func (k Key) isHMAC() bool {
+	_, ok := k.Method.(*jwt.SigningMethodHMAC)
+	return ok
+}
+
+// TokenConfig is what every token we mint carries and every token we accept
+// must match.
+type TokenConfig struct {
+	Issuer   string
+	Audience string
+	// tolerated clock difference between us and whoever minted the token
+	Leeway time.Duration
+}
+
+var DefaultTokenConfig = TokenConfig{
+	Issuer:   "chirpy",
+	Audience: "chirpy-api",
+	Leeway:   30 * time.Second,
+}
+
+type Keyring struct {
+	Tokens TokenConfig
+
+	signing Key
+	keys    map[string]Key
+	// used for tokens without a kid header, i.e. ones minted before rotation
+	// support existed
+	legacy *Key
+}
+
+// NewKeyring signs with signing and verifies with signing plus verifyOnly.
+func NewKeyring(signing Key, verifyOnly ...Key) (*Keyring, error) {
+	if signing.private == nil {
+		return nil, errors.New("signing key has no private part")
+	}
+
+	kr := &Keyring{Tokens: DefaultTokenConfig, signing: signing, keys: map[string]Key{}}
+	for _, k := range append([]Key{signing}, verifyOnly...) {
+		if _, dup := kr.keys[k.ID]; dup {
+			return nil, fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		kr.keys[k.ID] = k
+		if k.isHMAC() && kr.legacy == nil {
+			kr.legacy = &k
+		}
+	}
+
+	return kr, nil
+}
+
+func (kr *Keyring) MakeJWT(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+	return kr.MakeAccessToken(Principal{UserID: userID}, expiresIn)
+}
+
+// MakeAccessToken mints a token for p. TokenID is ignored, every token gets
+// a fresh jti.
+func (kr *Keyring) MakeAccessToken(p Principal, expiresIn time.Duration) (string, error) {
+	return kr.mint(p, kr.Tokens.Audience, uuid.NewString(), expiresIn)
+}
+
+// MakeMFAChallenge mints the short-lived token handed out after a correct
+// password when the account has two-factor enabled. It has its own audience
+// so it can't be used as an access token. id is its jti, for the caller to
+// make it single use.
+func (kr *Keyring) MakeMFAChallenge(userID uuid.UUID, expiresIn time.Duration) (token, id string, err error) {
+	id = uuid.NewString()
+	token, err = kr.mint(Principal{UserID: userID}, kr.mfaAudience(), id, expiresIn)
+	return token, id, err
+}
+
+// ParseMFAChallenge returns the challenge's user and, as TokenID, its jti.
+func (kr *Keyring) ParseMFAChallenge(tokenString string) (Principal, error) {
+	return kr.parse(tokenString, kr.mfaAudience())
+}
+
+func (kr *Keyring) mfaAudience() string {
+	return kr.Tokens.Audience + "/mfa"
+}
+
+func (kr *Keyring) mint(p Principal, audience, id string, expiresIn time.Duration) (string, error) {
+	sid := ""
+	if p.SessionID != uuid.Nil {
+		sid = p.SessionID.String()
+	}
+
+	now := time.Now().UTC()
+	token := jwt.NewWithClaims(kr.signing.Method, accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    kr.Tokens.Issuer,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject:   p.UserID.String(),
+			ID:        id,
+		},
+		Scope:     strings.Join(p.Scopes, " "),
+		Roles:     p.Roles,
+		SessionID: sid,
+		ClientID:  p.ClientID,
+	})
+
+	if kr.signing.ID != "" {
+		token.Header["kid"] = kr.signing.ID
+	}
+
+	return token.SignedString(kr.signing.private)
+}
+
+func (kr *Keyring) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	p, err := kr.ParseAccessToken(tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return p.UserID, nil
+}
+
+func (kr *Keyring) ParseAccessToken(tokenString string) (Principal, error) {
+	return kr.parse(tokenString, kr.Tokens.Audience)
+}
+
+func (kr *Keyring) parse(tokenString, audience string) (Principal, error) {
+	claims := accessClaims{}
+	/*
+		we are passing `&claims` ptr to claims cuz both
+		jwt.RegisteredClaims{} and it's ptr implements interface jwt.Claims
+		and ptr to claims allows for its modification
+	*/
+	_, err := jwt.ParseWithClaims(tokenString, &claims, kr.keyFunc,
+		jwt.WithValidMethods(kr.methods()),
+		jwt.WithIssuer(kr.Tokens.Issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(kr.Tokens.Leeway),
+	)
+	if err != nil {
+		return Principal{}, classifyTokenError(err)
+	}
+	// the parser checks nbf when present but has no option to require it
+	if claims.NotBefore == nil {
+		return Principal{}, fmt.Errorf("%w: missing nbf", ErrTokenMalformed)
+	}
+
+	p, err := claims.principal()
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: bad subject: %w", ErrTokenMalformed, err)
+	}
+
+	return p, nil
+}
+
+// methods is the allow-list of algorithms: only those of keys we hold.
+func (kr *Keyring) methods() []string {
+	seen := map[string]bool{}
+	var algs []string
+	for _, k := range kr.keys {
+		if alg := k.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// keyFunc picks the verification key by kid and refuses tokens whose alg
+// header doesn't match that key, so an RS256 public key can never be used
+// as an HMAC secret.
+func (kr *Keyring) keyFunc(t *jwt.Token) (any, error) {
+	var key Key
+	kid, hasKid := t.Header["kid"].(string)
+	switch {
+	case hasKid:
+		k, ok := kr.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKeyID, kid)
+		}
+		key = k
+	case kr.legacy != nil:
+		key = *kr.legacy
+	default:
+		return nil, ErrUnknownKeyID
+	}
+
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, ErrAlgorithmMismatch
+	}
+	return key.public, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP (Ed25519)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k Key) JWK() JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64(pub.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64(pub)
+	}
+	return jwk
+}
+
+// Thumbprint is the RFC 7638 SHA-256 thumbprint: the required members only,
+// in lexicographic order, no whitespace.
+func (j JWK) Thumbprint() string {
+	var canonical string
+	switch j.Kty {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, j.E, j.N)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, j.Crv, j.X)
+	default:
+		return ""
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JWKS returns every asymmetric public key in the ring, the signing key
+// first when it is one, then the verify-only keys by kid. Shared secrets are
+// never included, so an HMAC-only ring publishes an empty set.
+func (kr *Keyring) JWKS() JWKSet {
+	var verifyOnly []JWK
+	for id, k := range kr.keys {
+		if id == kr.signing.ID || k.isHMAC() {
+			continue
+		}
+		verifyOnly = append(verifyOnly, k.JWK())
+	}
+	sort.Slice(verifyOnly, func(i, j int) bool { return verifyOnly[i].Kid < verifyOnly[j].Kid })
+
+	set := JWKSet{Keys: []JWK{}}
+	if !kr.signing.isHMAC() {
+		set.Keys = append(set.Keys, kr.signing.JWK())
+	}
+	set.Keys = append(set.Keys, verifyOnly...)
+	return set
+}
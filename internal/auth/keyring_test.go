@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestKeyringRotation(t *testing.T) {
+	rsaPriv, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	oldKey, _ := NewKeyFromPrivate("old", rsaPriv)
+	newKey, _ := NewKeyFromPrivate("new", edPriv)
+	legacy := NewHMACKey("legacy", []byte("secret"))
+
+	before, err := NewKeyring(oldKey)
+	if err != nil {
+		t.Fatalf("NewKeyring() err = %v", err)
+	}
+	oldPub, _ := NewKeyFromPublic("old", &rsaPriv.PublicKey)
+	after, err := NewKeyring(newKey, oldPub, legacy)
+	if err != nil {
+		t.Fatalf("NewKeyring() err = %v", err)
+	}
+
+	userId := uuid.New()
+	oldToken, _ := before.MakeJWT(userId, time.Hour)
+	newToken, _ := after.MakeJWT(userId, time.Hour)
+	legacyToken, _ := MakeJWT(userId, "secret", time.Hour)
+	wrongSecretToken, _ := MakeJWT(userId, "wrong", time.Hour)
+
+	tests := []struct {
+		name    string
+		kr      *Keyring
+		token   string
+		wantErr bool
+	}{
+		{name: "New key", kr: after, token: newToken},
+		{name: "Rotated out key still verifies", kr: after, token: oldToken},
+		{name: "Token without kid uses legacy secret", kr: after, token: legacyToken},
+		{name: "Token without kid wrong secret", kr: after, token: wrongSecretToken, wantErr: true},
+		{name: "Unknown kid", kr: before, token: newToken, wantErr: true},
+		{name: "No legacy key", kr: before, token: legacyToken, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.kr.ValidateJWT(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateJWT() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != userId {
+				t.Errorf("ValidateJWT() = %v, want %v", got, userId)
+			}
+		})
+	}
+
+	jwks := after.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("JWKS() has %d keys, want 2 (no HMAC)", len(jwks.Keys))
+	}
+	if jwks.Keys[0].Kid != "new" || jwks.Keys[0].Kty != "OKP" || jwks.Keys[0].Alg != "EdDSA" {
+		t.Errorf("JWKS() first key = %+v, want the EdDSA signing key", jwks.Keys[0])
+	}
+	if jwks.Keys[1].Kty != "RSA" || jwks.Keys[1].E != "AQAB" {
+		t.Errorf("JWKS() second key = %+v, want RSA with e=AQAB", jwks.Keys[1])
+	}
+}
+
+func TestKeyringJWKSWithHMACSigningKey(t *testing.T) {
+	rsaPriv, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	rsaPub, _ := NewKeyFromPublic("b-rsa", &rsaPriv.PublicKey)
+	edPub, _ := NewKeyFromPublic("a-ed", edPriv.Public())
+
+	tests := []struct {
+		name     string
+		verify   []Key
+		wantKids []string
+	}{
+		{name: "HMAC only", wantKids: []string{}},
+		{name: "Verify-only keys sorted by kid", verify: []Key{rsaPub, edPub}, wantKids: []string{"a-ed", "b-rsa"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr, err := NewKeyring(NewHMACKey("k", []byte("secret")), tt.verify...)
+			if err != nil {
+				t.Fatalf("NewKeyring() err = %v", err)
+			}
+			jwks := kr.JWKS()
+			if jwks.Keys == nil {
+				t.Fatalf("JWKS() keys = nil, want an empty list")
+			}
+			kids := []string{}
+			for _, k := range jwks.Keys {
+				kids = append(kids, k.Kid)
+			}
+			if !slices.Equal(kids, tt.wantKids) {
+				t.Errorf("JWKS() kids = %v, want %v", kids, tt.wantKids)
+			}
+		})
+	}
+}
+
+func TestKeyringAlgorithmMismatch(t *testing.T) {
+	// an HS256 token whose kid points at an RSA key must not be verified with
+	// the public key bytes as the HMAC secret
+	rsaPriv, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaKey, _ := NewKeyFromPrivate("rsa", rsaPriv)
+	forger, _ := NewKeyring(NewHMACKey("rsa", x509.MarshalPKCS1PublicKey(&rsaPriv.PublicKey)))
+	forged, _ := forger.MakeJWT(uuid.New(), time.Hour)
+
+	// HS256 isn't allowed at all when we only hold an RSA key
+	rsaOnly, _ := NewKeyring(rsaKey)
+	if _, err := rsaOnly.ValidateJWT(forged); !errors.Is(err, ErrTokenBadSignature) {
+		t.Errorf("ValidateJWT() err = %v, want ErrTokenBadSignature", err)
+	}
+
+	// with an HMAC key around HS256 is allowed, but not for the RSA kid
+	mixed, _ := NewKeyring(rsaKey, NewHMACKey("legacy", []byte("secret")))
+	_, err := mixed.ValidateJWT(forged)
+	if !errors.Is(err, ErrAlgorithmMismatch) || !errors.Is(err, ErrTokenBadSignature) {
+		t.Errorf("ValidateJWT() err = %v, want ErrAlgorithmMismatch", err)
+	}
+}
+
+func TestParseKeyPEM(t *testing.T) {
+	_, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(edPriv)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	key, err := ParseKeyPEM("", data)
+	if err != nil {
+		t.Fatalf("ParseKeyPEM() err = %v", err)
+	}
+	if key.ID == "" || key.ID != key.JWK().Thumbprint() {
+		t.Errorf("ParseKeyPEM() ID = %q, want the JWK thumbprint", key.ID)
+	}
+
+	if _, err := ParseKeyPEM("", []byte("not pem")); err == nil {
+		t.Errorf("ParseKeyPEM() with garbage err = nil, want error")
+	}
+}
+
+func TestKeyringValidationErrors(t *testing.T) {
+	key := NewHMACKey("k", []byte("secret"))
+	kr, _ := NewKeyring(key)
+	userId := uuid.New()
+
+	expired, _ := kr.MakeJWT(userId, -time.Hour)
+	withinLeeway, _ := kr.MakeJWT(userId, -10*time.Second)
+
+	otherIssuer, _ := NewKeyring(key)
+	otherIssuer.Tokens.Issuer = "someone-else"
+	wrongIss, _ := otherIssuer.MakeJWT(userId, time.Hour)
+
+	otherAudience, _ := NewKeyring(key)
+	otherAudience.Tokens.Audience = "another-api"
+	wrongAud, _ := otherAudience.MakeJWT(userId, time.Hour)
+
+	badSecret, _ := NewKeyring(NewHMACKey("k", []byte("not the secret")))
+	badSig, _ := badSecret.MakeJWT(userId, time.Hour)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "Within clock skew", token: withinLeeway, wantErr: nil},
+		{name: "Expired", token: expired, wantErr: ErrTokenExpired},
+		{name: "Wrong issuer", token: wrongIss, wantErr: ErrTokenWrongIssuer},
+		{name: "Wrong audience", token: wrongAud, wantErr: ErrTokenWrongAudience},
+		{name: "Bad signature", token: badSig, wantErr: ErrTokenBadSignature},
+		{name: "Garbage", token: "not.a.jwt", wantErr: ErrTokenMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := kr.ValidateJWT(tt.token)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("ValidateJWT() err = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateJWT() err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyringAccessTokenPrincipal(t *testing.T) {
+	kr, _ := NewKeyring(NewHMACKey("k", []byte("secret")))
+	want := Principal{UserID: uuid.New(), Roles: []string{"admin"}, Scopes: []string{"chirps:read", "chirps:write"}, SessionID: uuid.New(), ClientID: "app-1"}
+
+	token, _ := kr.MakeAccessToken(want, time.Hour)
+	got, err := kr.ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("ParseAccessToken() err = %v", err)
+	}
+
+	if got.UserID != want.UserID || got.TokenID == "" {
+		t.Errorf("ParseAccessToken() = %+v, want user %v and a token id", got, want.UserID)
+	}
+	if got.SessionID != want.SessionID || got.ClientID != want.ClientID {
+		t.Errorf("ParseAccessToken() sid/client_id = %v/%q, want %v/%q", got.SessionID, got.ClientID, want.SessionID, want.ClientID)
+	}
+	if !got.HasRole("admin") || !got.HasScope("chirps:write") || got.HasScope("users:write") {
+		t.Errorf("ParseAccessToken() roles/scopes = %v/%v, want %v/%v", got.Roles, got.Scopes, want.Roles, want.Scopes)
+	}
+
+	session, _ := kr.MakeJWT(want.UserID, time.Hour)
+	got, _ = kr.ParseAccessToken(session)
+	if !got.HasScope("anything") {
+		t.Errorf("session token HasScope() = false, want unrestricted")
+	}
+}
+
+func TestKeyringMFAChallengeIsNotAnAccessToken(t *testing.T) {
+	kr, _ := NewKeyring(NewHMACKey("k", []byte("secret")))
+	userId := uuid.New()
+
+	challenge, id, _ := kr.MakeMFAChallenge(userId, time.Minute)
+	if got, err := kr.ParseMFAChallenge(challenge); err != nil || got.UserID != userId || got.TokenID != id {
+		t.Errorf("ParseMFAChallenge() = %+v, %v, want user %v jti %s", got, err, userId, id)
+	}
+	if _, err := kr.ParseAccessToken(challenge); !errors.Is(err, ErrTokenWrongAudience) {
+		t.Errorf("ParseAccessToken(challenge) err = %v, want ErrTokenWrongAudience", err)
+	}
+
+	access, _ := kr.MakeJWT(userId, time.Minute)
+	if _, err := kr.ParseMFAChallenge(access); !errors.Is(err, ErrTokenWrongAudience) {
+		t.Errorf("ParseMFAChallenge(access) err = %v, want ErrTokenWrongAudience", err)
+	}
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+	LoginLimiter tracks failed logins per key (we use one key for the account
+	and one for the client IP). The first FreeAttempts failures cost nothing,
+	after that each failure doubles the wait before the next attempt is allowed:
+
+		BaseDelay, 2*BaseDelay, 4*BaseDelay, ... capped at MaxDelay
+
+	Once the wait reaches MaxDelay the key is effectively locked out for that
+	long. A successful login resets the account key; IP keys only decay, so a
+	single attacker can't unlock themselves by logging into their own account.
+
+	An attempt counts as failed the moment Allow lets it through, before the
+	password is even checked. Otherwise a burst of concurrent guesses would
+	all pass Allow before the first of them was recorded as a failure.
+	Attempts that turn out fine are taken back with Release.
+*/
+
+type LoginLimiterConfig struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	// failures older than this are forgotten
+	Window time.Duration
+}
+
+var DefaultLoginLimiterConfig = LoginLimiterConfig{
+	FreeAttempts: 5,
+	BaseDelay:    time.Second,
+	MaxDelay:     15 * time.Minute,
+	Window:       time.Hour,
+}
+
+type loginFailures struct {
+	count       int
+	lastFailure time.Time
+	blockedTill time.Time
+}
+
+type LoginLimiter struct {
+	cfg LoginLimiterConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*loginFailures
+}
+
+func NewLoginLimiter(cfg LoginLimiterConfig) *LoginLimiter {
+	return &LoginLimiter{
+		cfg:     cfg,
+		now:     time.Now,
+		entries: map[string]*loginFailures{},
+	}
+}
+
+// Allow reports how long the caller must wait before any of keys may attempt
+// another login. Zero means go ahead, and the attempt has then already been
+// counted as failed against every key; Release it if it succeeds.
+func (l *LoginLimiter) Allow(keys ...string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if wait := l.wait(now, keys); wait > 0 {
+		return wait
+	}
+
+	for _, k := range keys {
+		e := l.entry(k, now)
+		if e == nil {
+			e = &loginFailures{}
+			l.entries[k] = e
+		}
+		e.count++
+		e.lastFailure = now
+		if d := l.delay(e.count); d > 0 {
+			e.blockedTill = now.Add(d)
+		}
+	}
+	return 0
+}
+
+// Wait returns how long the longest blocked of keys must wait, for telling a
+// client whose attempt failed when to come back.
+func (l *LoginLimiter) Wait(keys ...string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.wait(l.now(), keys)
+}
+
+// Release takes back the failure Allow counted against each of keys, for an
+// attempt that didn't fail after all.
+func (l *LoginLimiter) Release(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for _, k := range keys {
+		e := l.entry(k, now)
+		if e == nil {
+			continue
+		}
+		e.count--
+		if e.count <= 0 {
+			delete(l.entries, k)
+			continue
+		}
+		if l.delay(e.count) == 0 {
+			e.blockedTill = time.Time{}
+		}
+	}
+}
+
+// Reset forgets all failures for key.
+func (l *LoginLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
+
+// Prune drops entries whose failures have all aged out of the window.
+func (l *LoginLimiter) Prune() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	pruned := 0
+	for k, e := range l.entries {
+		if l.expired(e, now) {
+			delete(l.entries, k)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// wait is Wait for callers holding l.mu.
+func (l *LoginLimiter) wait(now time.Time, keys []string) time.Duration {
+	var wait time.Duration
+	for _, k := range keys {
+		e := l.entry(k, now)
+		if e == nil {
+			continue
+		}
+		if d := e.blockedTill.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// entry returns the live entry for key, dropping it if it has expired.
+// Caller holds l.mu.
+func (l *LoginLimiter) entry(key string, now time.Time) *loginFailures {
+	e, ok := l.entries[key]
+	if !ok {
+		return nil
+	}
+	if l.expired(e, now) {
+		delete(l.entries, key)
+		return nil
+	}
+	return e
+}
+
+func (l *LoginLimiter) expired(e *loginFailures, now time.Time) bool {
+	return now.Sub(e.lastFailure) > l.cfg.Window && !now.Before(e.blockedTill)
+}
+
+func (l *LoginLimiter) delay(failures int) time.Duration {
+	over := failures - l.cfg.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+
+	d := l.cfg.BaseDelay
+	for i := 1; i < over; i++ {
+		d *= 2
+		if d >= l.cfg.MaxDelay {
+			return l.cfg.MaxDelay
+		}
+	}
+	return min(d, l.cfg.MaxDelay)
+}
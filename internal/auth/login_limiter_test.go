@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoginLimiter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLoginLimiter(LoginLimiterConfig{
+		FreeAttempts: 2,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Second,
+		Window:       time.Minute,
+	})
+	l.now = func() time.Time { return now }
+
+	// free attempts
+	for i := range 2 {
+		if wait := l.Allow("acct:a"); wait != 0 {
+			t.Fatalf("Allow() #%d wait = %v, want 0", i+1, wait)
+		}
+		if wait := l.Wait("acct:a"); wait != 0 {
+			t.Fatalf("Wait() after failure #%d = %v, want 0", i+1, wait)
+		}
+	}
+
+	// then exponential backoff, capped
+	wantWaits := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, want := range wantWaits {
+		if wait := l.Allow("acct:a"); wait != 0 {
+			t.Fatalf("Allow() backoff #%d wait = %v, want 0", i+1, wait)
+		}
+		if got := l.Wait("acct:a"); got != want {
+			t.Fatalf("Wait() backoff #%d = %v, want %v", i+1, got, want)
+		}
+		now = now.Add(want)
+	}
+	now = now.Add(-5 * time.Second)
+
+	if wait := l.Allow("acct:a", "ip:1.2.3.4"); wait != 5*time.Second {
+		t.Errorf("Allow() wait = %v, want 5s", wait)
+	}
+	if wait := l.Wait("ip:1.2.3.4"); wait != 0 {
+		t.Errorf("refused attempt was counted against the IP, wait = %v", wait)
+	}
+	if wait := l.Allow("acct:b"); wait != 0 {
+		t.Errorf("Allow() for other account wait = %v, want 0", wait)
+	}
+
+	now = now.Add(5 * time.Second)
+	if wait := l.Allow("acct:a"); wait != 0 {
+		t.Errorf("Allow() after lockout wait = %v, want 0", wait)
+	}
+
+	l.Reset("acct:a")
+	if wait := l.Allow("acct:a"); wait != 0 {
+		t.Errorf("Allow() after Reset wait = %v, want 0", wait)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if n := l.Prune(); n != 2 {
+		t.Errorf("Prune() = %d, want 2", n)
+	}
+}
+
+func TestLoginLimiterRelease(t *testing.T) {
+	l := NewLoginLimiter(LoginLimiterConfig{
+		FreeAttempts: 1,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		Window:       time.Minute,
+	})
+
+	// successful logins don't add up
+	for i := range 5 {
+		if wait := l.Allow("ip:1.2.3.4"); wait != 0 {
+			t.Fatalf("Allow() #%d wait = %v, want 0", i+1, wait)
+		}
+		l.Release("ip:1.2.3.4")
+	}
+	if n := len(l.entries); n != 0 {
+		t.Errorf("%d entries left after released attempts, want 0", n)
+	}
+
+	// releasing one attempt of a failed pair lifts the block it caused
+	l.Allow("ip:1.2.3.4")
+	l.Allow("ip:1.2.3.4")
+	if wait := l.Wait("ip:1.2.3.4"); wait == 0 {
+		t.Fatalf("Wait() = 0 after two failures, want a block")
+	}
+	l.Release("ip:1.2.3.4")
+	if wait := l.Wait("ip:1.2.3.4"); wait != 0 {
+		t.Errorf("Wait() = %v after Release, want 0", wait)
+	}
+}
+
+func TestLoginLimiterConcurrentAttempts(t *testing.T) {
+	l := NewLoginLimiter(LoginLimiterConfig{
+		FreeAttempts: 3,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+	})
+
+	// every guess checks its password only after all have asked Allow
+	const guesses = 50
+	var allowed sync.WaitGroup
+	var mu sync.Mutex
+	passed := 0
+	allowed.Add(guesses)
+	for range guesses {
+		go func() {
+			defer allowed.Done()
+			if l.Allow("acct:a", "ip:1.2.3.4") == 0 {
+				mu.Lock()
+				passed++
+				mu.Unlock()
+			}
+		}()
+	}
+	allowed.Wait()
+
+	// the free attempts plus the one that earned the first delay
+	if passed != 4 {
+		t.Errorf("%d of %d concurrent guesses let through, want 4", passed, guesses)
+	}
+}
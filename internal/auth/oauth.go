@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+)
+
+/*
+	Helpers for Chirpy acting as an OAuth2 authorization server for third
+	party apps. Only the authorization code grant with PKCE (RFC 7636, S256)
+	is supported; "plain" challenges and the implicit grant are not.
+
+	Client secrets get a prefix for the same reason personal access tokens
+	do: so secret scanners can recognise a leaked one.
+*/
+
+const ClientSecretPrefix = "chirpy_cs_"
+
+var ErrInvalidRedirectURI = errors.New("redirect uri must be an absolute https url, or http on a loopback address, without a fragment")
+
+func MakeClientSecret() (string, error) {
+	token, err := MakeOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	return ClientSecretPrefix + token, nil
+}
+
+// VerifyPKCE checks verifier against an S256 code_challenge.
+func VerifyPKCE(verifier, challenge string) bool {
+	// RFC 7636 4.1: 43 to 128 characters
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	want := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(want), []byte(challenge)) == 1
+}
+
+// CheckRedirectURI is applied when a client registers its redirect URIs.
+// At authorization time the requested URI must then match one of them
+// exactly; no prefix or wildcard matching.
+func CheckRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+		return ErrInvalidRedirectURI
+	}
+
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		// native apps listen on a loopback port (RFC 8252 7.3)
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	return ErrInvalidRedirectURI
+}
+
+// ParseScope splits an OAuth scope parameter and checks every scope is one
+// a user may grant. An empty parameter yields no scopes.
+func ParseScope(scope string) ([]string, error) {
+	return CheckGrantableScopes(strings.Fields(scope))
+}
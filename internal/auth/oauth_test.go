@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636 appendix B
+	const (
+		verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	)
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{"RFC vector", verifier, challenge, true},
+		{"Wrong verifier", strings.Replace(verifier, "d", "e", 1), challenge, false},
+		{"Plain challenge", verifier, verifier, false},
+		{"Verifier too short", "abc", "ungWv48Bz-pBQUDeXa4iI7ADYaOWF3qctBD_YfIAFa0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("VerifyPKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckRedirectURI(t *testing.T) {
+	tests := []struct {
+		uri     string
+		wantErr bool
+	}{
+		{"https://app.example.com/callback", false},
+		{"http://localhost:5173/callback", false},
+		{"http://127.0.0.1:49152/cb", false},
+		{"http://app.example.com/callback", true},
+		{"https://app.example.com/callback#frag", true},
+		{"/callback", true},
+		{"javascript:alert(1)", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			if err := CheckRedirectURI(tt.uri); (err != nil) != tt.wantErr {
+				t.Errorf("CheckRedirectURI(%q) err = %v, wantErr %v", tt.uri, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// MakeOpaqueToken returns 256 random bits as hex. Used for anything the
+// client just hands back to us: refresh tokens, email links, etc.
+func MakeOpaqueToken() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// HashOpaqueToken is what we store and look tokens up by. The tokens are
+// 256 random bits, so a plain SHA-256 is enough; there's nothing to brute
+// force and lookups stay a simple indexed equality.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,18 +1,206 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+/*
+	Stored hashes are self describing so we can change algorithms or cost
+	parameters without a migration:
+
+		argon2id -> $argon2id$v=19$m=65536,t=3,p=2$<salt b64>$<key b64>   (PHC string format)
+		bcrypt   -> $2a$10$...  /  $2b$...                                 (what bcrypt already emits)
+
+	CheckPasswordHash reports needsRehash=true when the stored hash was made
+	with a different algorithm or weaker parameters than the current hasher.
+	The login handler uses that to re-hash with the current settings while it
+	still has the plaintext password in hand.
+*/
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// UnusablePasswordHash is stored for accounts that only sign in through an
+// external identity provider. It isn't a valid hash, so Check rejects every
+// password against it.
+const UnusablePasswordHash = "!"
+
+type Argon2Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the OWASP recommendation for argon2id.
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+type PasswordHasher struct {
+	Algorithm  string
+	Argon2     Argon2Params
+	BcryptCost int
+}
+
+var DefaultPasswordHasher = PasswordHasher{
+	Algorithm:  AlgorithmArgon2id,
+	Argon2:     DefaultArgon2Params,
+	BcryptCost: bcrypt.DefaultCost,
+}
+
+// Validate reports settings that argon2 or bcrypt would reject, argon2 by
+// panicking on every call. Run it once at startup rather than finding out at
+// the first signup.
+func (h PasswordHasher) Validate() error {
+	switch h.Algorithm {
+	case AlgorithmArgon2id, AlgorithmBcrypt:
+	default:
+		return fmt.Errorf("unsupported password hash algorithm %q", h.Algorithm)
+	}
+
+	p := h.Argon2
+	if p.Iterations < 1 {
+		return errors.New("argon2 iterations must be at least 1")
+	}
+	if p.Parallelism < 1 {
+		return errors.New("argon2 parallelism must be between 1 and 255")
+	}
+	if uint64(p.Memory) < 8*uint64(p.Parallelism) {
+		return fmt.Errorf("argon2 memory must be at least 8 KiB per thread, %d KiB for parallelism %d", 8*uint32(p.Parallelism), p.Parallelism)
+	}
+	if p.SaltLength < 8 || p.KeyLength < 16 {
+		return errors.New("argon2 salt must be at least 8 bytes and key at least 16")
+	}
+	if h.BcryptCost < bcrypt.MinCost || h.BcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return nil
+}
+
 func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
+	return DefaultPasswordHasher.Hash(password)
+}
+
+func CheckPasswordHash(hash, password string) (needsRehash bool, err error) {
+	return DefaultPasswordHasher.Check(hash, password)
+}
+
+func (h PasswordHasher) Hash(password string) (string, error) {
+	switch h.Algorithm {
+	case AlgorithmArgon2id:
+		salt := make([]byte, h.Argon2.SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, h.Argon2.Iterations, h.Argon2.Memory, h.Argon2.Parallelism, h.Argon2.KeyLength)
+		return encodeArgon2id(h.Argon2, salt, key), nil
+
+	case AlgorithmBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
 	}
 
-	return string(hash), nil
+	return "", fmt.Errorf("unsupported password hash algorithm %q", h.Algorithm)
+}
+
+// Check returns nil if password matches hash. needsRehash is only meaningful
+// when err is nil.
+func (h PasswordHasher) Check(hash, password string) (needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, bcrypt.ErrMismatchedHashAndPassword
+		}
+		return h.Algorithm != AlgorithmArgon2id || h.argon2NeedsRehash(params), nil
+
+	case strings.HasPrefix(hash, "$2"):
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			return false, err
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return false, err
+		}
+		return h.Algorithm != AlgorithmBcrypt || cost != h.BcryptCost, nil
+	}
+
+	return false, ErrUnknownHashFormat
+}
+
+func (h PasswordHasher) argon2NeedsRehash(stored Argon2Params) bool {
+	cur := h.Argon2
+	return stored.Memory != cur.Memory ||
+		stored.Iterations != cur.Iterations ||
+		stored.Parallelism != cur.Parallelism ||
+		stored.SaltLength < cur.SaltLength ||
+		stored.KeyLength < cur.KeyLength
+}
+
+func encodeArgon2id(p Argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
 }
 
-func CheckPasswordHash(hash, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+func decodeArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, ErrUnknownHashFormat
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrUnknownHashFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrUnknownHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, ErrUnknownHashFormat
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+
+	return p, salt, key, nil
 }
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrPasswordTooShort      = errors.New("password is too short")
+	ErrPasswordTooLong       = errors.New("password is too long")
+	ErrPasswordTooSimple     = errors.New("password does not mix enough character types")
+	ErrPasswordMatchesEmail  = errors.New("password must not match the email address")
+	ErrPasswordBreached      = errors.New("password has appeared in a data breach")
+	ErrPasswordBadCharacters = errors.New("password contains control characters")
+)
+
+/*
+	bcrypt only looks at the first 72 bytes of the password, anything after
+	that is silently dropped. So "<72 bytes>A" and "<72 bytes>B" hash the same.
+	Rather than letting that happen we reject long passwords with a clear error.
+
+	Length is counted in bytes for the max (that's what bcrypt cares about) and
+	in characters for the min (that's what the user thinks in).
+*/
+
+const bcryptMaxPasswordBytes = 72
+
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// how many of lower, upper, digit and symbol must appear
+	MinCharClasses int
+	// nil disables the breached-password check
+	Breached BreachedPasswordChecker
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:      8,
+		MaxLength:      bcryptMaxPasswordBytes,
+		MinCharClasses: 3,
+		Breached:       BundledBreachedPasswords(),
+	}
+}
+
+// Check returns nil if password is acceptable for the account with the given
+// email. Errors wrap one of the ErrPassword* values.
+func (p PasswordPolicy) Check(password, email string) error {
+	if n := len([]rune(password)); n < p.MinLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrPasswordTooShort, p.MinLength)
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return fmt.Errorf("%w: must be at most %d bytes", ErrPasswordTooLong, p.MaxLength)
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsControl(r):
+			return ErrPasswordBadCharacters
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, ok := range []bool{lower, upper, digit, symbol} {
+		if ok {
+			classes++
+		}
+	}
+	if classes < p.MinCharClasses {
+		return fmt.Errorf("%w: use at least %d of lowercase, uppercase, digits and symbols", ErrPasswordTooSimple, p.MinCharClasses)
+	}
+
+	if email != "" {
+		lowerPass := strings.ToLower(password)
+		lowerEmail := strings.ToLower(email)
+		local, _, _ := strings.Cut(lowerEmail, "@")
+		if lowerPass == lowerEmail || lowerPass == local {
+			return ErrPasswordMatchesEmail
+		}
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.IsBreached(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return ErrPasswordBreached
+		}
+	}
+
+	return nil
+}
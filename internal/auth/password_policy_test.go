@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		wantErr  error
+	}{
+		{
+			name:     "Valid password",
+			password: "Correct-Horse-42",
+			email:    "user@example.com",
+			wantErr:  nil,
+		},
+		{
+			name:     "Empty password",
+			password: "",
+			email:    "user@example.com",
+			wantErr:  ErrPasswordTooShort,
+		},
+		{
+			name:     "Too short",
+			password: "Ab1!",
+			email:    "user@example.com",
+			wantErr:  ErrPasswordTooShort,
+		},
+		{
+			name:     "Longer than bcrypt limit",
+			password: "Aa1!" + strings.Repeat("x", 70),
+			email:    "user@example.com",
+			wantErr:  ErrPasswordTooLong,
+		},
+		{
+			name:     "Single character class",
+			password: "alllowercaseletters",
+			email:    "user@example.com",
+			wantErr:  ErrPasswordTooSimple,
+		},
+		{
+			name:     "Matches email",
+			password: "User@Example.com",
+			email:    "user@example.com",
+			wantErr:  ErrPasswordMatchesEmail,
+		},
+		{
+			name:     "Matches email local part",
+			password: "Jane.Doe99",
+			email:    "jane.doe99@example.com",
+			wantErr:  ErrPasswordMatchesEmail,
+		},
+		{
+			name:     "Breached password",
+			password: "Password123",
+			email:    "user@example.com",
+			wantErr:  ErrPasswordBreached,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password, tt.email)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Check() err = %v, wantErr = %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBreachedPasswords(t *testing.T) {
+	// SHA-1 of "hunter2"
+	list, err := LoadBreachedPasswords(strings.NewReader("# comment\n\nf3bbbd66a63d4bf1747940578ec3d0103530e21d:12\n"))
+	if err != nil {
+		t.Fatalf("LoadBreachedPasswords() err = %v", err)
+	}
+
+	if ok, _ := list.IsBreached("hunter2"); !ok {
+		t.Errorf("IsBreached(hunter2) = false, want true")
+	}
+	if ok, _ := list.IsBreached("hunter3"); ok {
+		t.Errorf("IsBreached(hunter3) = true, want false")
+	}
+
+	if _, err := LoadBreachedPasswords(strings.NewReader("nothex\n")); err == nil {
+		t.Errorf("LoadBreachedPasswords() with bad line err = nil, want error")
+	}
+}
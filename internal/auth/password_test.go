@@ -2,6 +2,8 @@ package auth
 
 import (
 	"testing"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestCheckPasswordHash(t *testing.T) {
@@ -50,10 +52,123 @@ func TestCheckPasswordHash(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := CheckPasswordHash(tt.hash, tt.password)
+			_, err := CheckPasswordHash(tt.hash, tt.password)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("CheckPasswordHash() err = %v, wantErr = %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestCheckPasswordHashNeedsRehash(t *testing.T) {
+	password := "correctPassword123!"
+
+	// keep the tests fast, the parameters only need to differ
+	cheap := Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	current := PasswordHasher{Algorithm: AlgorithmArgon2id, Argon2: cheap, BcryptCost: bcrypt.MinCost}
+
+	stronger := current
+	stronger.Argon2.Iterations = 2
+
+	bcryptHasher := current
+	bcryptHasher.Algorithm = AlgorithmBcrypt
+
+	argonHash, _ := current.Hash(password)
+	bcryptHash, _ := bcryptHasher.Hash(password)
+
+	tests := []struct {
+		name       string
+		hasher     PasswordHasher
+		hash       string
+		wantRehash bool
+		wantErr    bool
+	}{
+		{
+			name:       "Argon2id with current params",
+			hasher:     current,
+			hash:       argonHash,
+			wantRehash: false,
+		},
+		{
+			name:       "Argon2id with weaker params",
+			hasher:     stronger,
+			hash:       argonHash,
+			wantRehash: true,
+		},
+		{
+			name:       "Bcrypt hash when argon2id is configured",
+			hasher:     current,
+			hash:       bcryptHash,
+			wantRehash: true,
+		},
+		{
+			name:       "Bcrypt hash when bcrypt is configured",
+			hasher:     bcryptHasher,
+			hash:       bcryptHash,
+			wantRehash: false,
+		},
+		{
+			name:    "Malformed argon2id hash",
+			hasher:  current,
+			hash:    "$argon2id$v=19$m=1024$nope",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rehash, err := tt.hasher.Check(tt.hash, password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check() err = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if rehash != tt.wantRehash {
+				t.Errorf("Check() needsRehash = %v, want = %v", rehash, tt.wantRehash)
+			}
+		})
+	}
+}
+
+func TestPasswordHasherValidate(t *testing.T) {
+	with := func(f func(h *PasswordHasher)) PasswordHasher {
+		h := DefaultPasswordHasher
+		f(&h)
+		return h
+	}
+
+	tests := []struct {
+		name    string
+		hasher  PasswordHasher
+		wantErr bool
+	}{
+		{name: "default", hasher: DefaultPasswordHasher},
+		{name: "bcrypt", hasher: with(func(h *PasswordHasher) { h.Algorithm = AlgorithmBcrypt })},
+		{name: "unknown algorithm", hasher: with(func(h *PasswordHasher) { h.Algorithm = "md5" }), wantErr: true},
+		{name: "zero iterations", hasher: with(func(h *PasswordHasher) { h.Argon2.Iterations = 0 }), wantErr: true},
+		{name: "zero parallelism", hasher: with(func(h *PasswordHasher) { h.Argon2.Parallelism = 0 }), wantErr: true},
+		{name: "max parallelism", hasher: with(func(h *PasswordHasher) { h.Argon2.Parallelism = 255 })},
+		{name: "memory below 8 KiB per thread", hasher: with(func(h *PasswordHasher) { h.Argon2.Memory = 15 }), wantErr: true},
+		{name: "memory at 8 KiB per thread", hasher: with(func(h *PasswordHasher) { h.Argon2.Memory = 16 })},
+		{name: "bcrypt cost too low", hasher: with(func(h *PasswordHasher) { h.BcryptCost = bcrypt.MinCost - 1 }), wantErr: true},
+		{name: "bcrypt cost too high", hasher: with(func(h *PasswordHasher) { h.BcryptCost = bcrypt.MaxCost + 1 }), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.hasher.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			// anything Validate lets through must hash without panicking
+			hash, err := tt.hasher.Hash("correctPassword123!")
+			if err != nil {
+				t.Fatalf("Hash() err = %v", err)
+			}
+			if _, err := tt.hasher.Check(hash, "correctPassword123!"); err != nil {
+				t.Errorf("Check() err = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+/*
+	Personal access tokens look like
+
+		chirpy_pat_3f9c...64 hex chars
+
+	The fixed prefix lets the auth middleware tell them apart from JWTs
+	without trying to parse them, and lets secret scanners (GitHub, gitleaks)
+	spot one that was committed by accident.
+*/
+
+const PATPrefix = "chirpy_pat_"
+
+const (
+	ScopeChirpsRead  = "chirps:read"
+	ScopeChirpsWrite = "chirps:write"
+	// reading and marking your notifications, including live over the
+	// WebSocket
+	ScopeNotifications = "notifications"
+	// account management: passwords, sessions, 2FA, tokens. Never grantable
+	// to a token, only a real login has it (via unrestricted scopes).
+	ScopeAccount = "account"
+)
+
+// GrantableScopes are the scopes a user may put on a personal access token.
+var GrantableScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeNotifications}
+
+func MakePersonalAccessToken() (string, error) {
+	token, err := MakeOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	return PATPrefix + token, nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PATPrefix)
+}
+
+// CheckGrantableScopes returns the scopes deduplicated and sorted, or an
+// error naming the first one that can't be granted.
+func CheckGrantableScopes(scopes []string) ([]string, error) {
+	out := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		if !slices.Contains(GrantableScopes, s) {
+			return nil, fmt.Errorf("unknown scope %q, must be one of %s", s, strings.Join(GrantableScopes, ", "))
+		}
+		if !slices.Contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	slices.Sort(out)
+	return out, nil
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMakePersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("MakePersonalAccessToken() err = %v", err)
+	}
+	if !IsPersonalAccessToken(token) || len(token) != len(PATPrefix)+64 {
+		t.Errorf("MakePersonalAccessToken() = %q, want %s followed by 64 hex chars", token, PATPrefix)
+	}
+	if IsPersonalAccessToken("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Errorf("IsPersonalAccessToken(jwt) = true, want false")
+	}
+}
+
+func TestCheckGrantableScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "Dedup and sort",
+			scopes: []string{ScopeChirpsWrite, ScopeChirpsRead, ScopeChirpsWrite},
+			want:   []string{ScopeChirpsRead, ScopeChirpsWrite},
+		},
+		{
+			name:   "Empty",
+			scopes: nil,
+			want:   []string{},
+		},
+		{
+			name:    "Account scope is not grantable",
+			scopes:  []string{ScopeAccount},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown scope",
+			scopes:  []string{"chirps:admin"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CheckGrantableScopes(tt.scopes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckGrantableScopes() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(got, tt.want) {
+				t.Errorf("CheckGrantableScopes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Principal is whoever a request is authenticated as.
+type Principal struct {
+	UserID uuid.UUID
+	Roles  []string
+	// nil means unrestricted, which is what a normal login gets. Tokens for
+	// bots and third party apps carry an explicit list.
+	Scopes  []string
+	TokenID string
+	// the refresh token row this access token was minted from, if any: a
+	// login session, or for ClientID tokens the OAuth grant
+	SessionID uuid.UUID
+	// set when a third party app holds the token on the user's behalf
+	ClientID string
+	IssuedAt time.Time
+	// zero for tokens that don't expire
+	ExpiresAt time.Time
+}
+
+func (p Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+func (p Principal) HasScope(scope string) bool {
+	return p.Scopes == nil || slices.Contains(p.Scopes, scope)
+}
+
+// accessClaims is what we put in an access token on top of the registered
+// claims. Scopes are space separated, as in OAuth2.
+type accessClaims struct {
+	jwt.RegisteredClaims
+	Scope     string   `json:"scope,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+}
+
+func (c accessClaims) principal() (Principal, error) {
+	id, err := uuid.Parse(c.Subject)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	p := Principal{UserID: id, Roles: c.Roles, TokenID: c.ID, ClientID: c.ClientID}
+	if c.Scope != "" {
+		p.Scopes = strings.Fields(c.Scope)
+	}
+	if c.IssuedAt != nil {
+		p.IssuedAt = c.IssuedAt.Time
+	}
+	if c.ExpiresAt != nil {
+		p.ExpiresAt = c.ExpiresAt.Time
+	}
+	if c.SessionID != "" {
+		if p.SessionID, err = uuid.Parse(c.SessionID); err != nil {
+			return Principal{}, err
+		}
+	}
+	return p, nil
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
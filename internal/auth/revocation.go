@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+/*
+	Login access tokens are JWTs checked without a database lookup, so
+	revoking a session in the database only stops its refresh token; the
+	access token would keep working until it expires. RevocationList closes
+	that gap: it remembers revoked sessions (and users whose sessions were all
+	revoked) for as long as an access token can live, and middlewareAuth
+	rejects tokens it matches. Every instance keeps its own list, fed by
+	revocation events from the event bus, and from the database at startup
+	and whenever the bus may have dropped events.
+*/
+
+type userRevocation struct {
+	// sessions' tokens issued before this are revoked
+	before time.Time
+	// except this one's, e.g. "log out everywhere else"
+	except uuid.UUID
+}
+
+type RevocationList struct {
+	// ttl is the longest an access token lives; entries older than that
+	// can't match anything anymore.
+	ttl time.Duration
+	now func() time.Time
+
+	mu       sync.Mutex
+	sessions map[uuid.UUID]time.Time // revoked at
+	users    map[uuid.UUID]userRevocation
+}
+
+func NewRevocationList(ttl time.Duration) *RevocationList {
+	return &RevocationList{
+		ttl:      ttl,
+		now:      time.Now,
+		sessions: map[uuid.UUID]time.Time{},
+		users:    map[uuid.UUID]userRevocation{},
+	}
+}
+
+// RevokeSession revokes the access tokens of one session.
+func (l *RevocationList) RevokeSession(id uuid.UUID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sessions[id] = l.now()
+}
+
+// RevokeUser revokes the access tokens of every session of userID issued
+// before at, except those of session except (uuid.Nil for none).
+func (l *RevocationList) RevokeUser(userID uuid.UUID, at time.Time, except uuid.UUID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.users[userID] = userRevocation{before: at, except: except}
+}
+
+// Revoked reports whether p's token was revoked. Only session tokens are
+// covered; personal access tokens and OAuth tokens are checked against the
+// database on every request, and on every ping of a WebSocket they opened.
+func (l *RevocationList) Revoked(p Principal) bool {
+	if p.SessionID == uuid.Nil || p.ClientID != "" {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.sessions[p.SessionID]; ok {
+		return true
+	}
+	u, ok := l.users[p.UserID]
+	// iat only has second precision; a token from the same second as the
+	// revocation, usually the new login that prompted it, is let through
+	return ok && p.SessionID != u.except && p.IssuedAt.Before(u.before.Truncate(time.Second))
+}
+
+// Prune forgets revocations older than any token they could match.
+func (l *RevocationList) Prune() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := l.now().Add(-l.ttl)
+	pruned := 0
+	for id, at := range l.sessions {
+		if at.Before(cutoff) {
+			delete(l.sessions, id)
+			pruned++
+		}
+	}
+	for id, u := range l.users {
+		if u.before.Before(cutoff) {
+			delete(l.users, id)
+			pruned++
+		}
+	}
+	return pruned
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRevocationList(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := NewRevocationList(time.Hour)
+	l.now = func() time.Time { return now }
+
+	alice, bob := uuid.New(), uuid.New()
+	loggedOut, current, other := uuid.New(), uuid.New(), uuid.New()
+	l.RevokeSession(loggedOut)
+	l.RevokeUser(bob, now.Add(500*time.Millisecond), current)
+
+	tests := []struct {
+		name string
+		p    Principal
+		want bool
+	}{
+		{
+			name: "Revoked session",
+			p:    Principal{UserID: alice, SessionID: loggedOut, IssuedAt: now.Add(-time.Minute)},
+			want: true,
+		},
+		{
+			name: "Other session of same user",
+			p:    Principal{UserID: alice, SessionID: other, IssuedAt: now.Add(-time.Minute)},
+			want: false,
+		},
+		{
+			name: "User revocation, older token",
+			p:    Principal{UserID: bob, SessionID: other, IssuedAt: now.Add(-time.Minute)},
+			want: true,
+		},
+		{
+			name: "User revocation, excepted session",
+			p:    Principal{UserID: bob, SessionID: current, IssuedAt: now.Add(-time.Minute)},
+			want: false,
+		},
+		{
+			name: "User revocation, token from the same second",
+			p:    Principal{UserID: bob, SessionID: other, IssuedAt: now},
+			want: false,
+		},
+		{
+			name: "User revocation, newer token",
+			p:    Principal{UserID: bob, SessionID: other, IssuedAt: now.Add(time.Minute)},
+			want: false,
+		},
+		{
+			name: "Not a session token",
+			p:    Principal{UserID: bob, IssuedAt: now.Add(-time.Minute)},
+			want: false,
+		},
+		{
+			name: "OAuth token",
+			p:    Principal{UserID: alice, SessionID: loggedOut, ClientID: "app", IssuedAt: now.Add(-time.Minute)},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := l.Revoked(tt.p); got != tt.want {
+				t.Errorf("Revoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	now = now.Add(2 * time.Hour)
+	if n := l.Prune(); n != 2 {
+		t.Errorf("Prune() = %d, want 2", n)
+	}
+	if l.Revoked(Principal{UserID: alice, SessionID: loggedOut}) {
+		t.Errorf("Revoked() after Prune = true, want false")
+	}
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/url"
+	"strings"
+	"time"
+)
+
+/*
+	TOTP (RFC 6238) is HOTP (RFC 4226) with the counter replaced by
+	floor(unix time / period):
+
+		mac  = HMAC(secret, counter as 8 byte big endian)
+		off  = last nibble of mac
+		code = (mac[off:off+4] & 0x7fffffff) mod 10^digits
+
+	Authenticator apps only reliably support the defaults (SHA1, 6 digits,
+	30s), the other algorithms are here for the RFC test vectors.
+*/
+
+type TOTPConfig struct {
+	Digits    int
+	Period    time.Duration
+	Algorithm string // SHA1, SHA256 or SHA512
+	// how many periods either side of now we accept, for clock drift and
+	// the user typing slowly
+	Skew int64
+}
+
+var DefaultTOTPConfig = TOTPConfig{
+	Digits:    6,
+	Period:    30 * time.Second,
+	Algorithm: "SHA1",
+	Skew:      1,
+}
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns 160 random bits, the size RFC 4226 recommends.
+func GenerateTOTPSecret() ([]byte, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EncodeTOTPSecret is the base32 form authenticator apps expect.
+func EncodeTOTPSecret(secret []byte) string {
+	return totpEncoding.EncodeToString(secret)
+}
+
+func DecodeTOTPSecret(s string) ([]byte, error) {
+	return totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(s, "=")))
+}
+
+func (c TOTPConfig) newHash() func() hash.Hash {
+	switch c.Algorithm {
+	case "SHA256":
+		return sha256.New
+	case "SHA512":
+		return sha512.New
+	}
+	return sha1.New
+}
+
+func (c TOTPConfig) step(t time.Time) int64 {
+	return t.Unix() / int64(c.Period/time.Second)
+}
+
+func (c TOTPConfig) codeAt(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(c.newHash(), secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	off := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range c.Digits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", c.Digits, bin%mod)
+}
+
+// Code is the code an authenticator shows at time t.
+func (c TOTPConfig) Code(secret []byte, t time.Time) string {
+	return c.codeAt(secret, c.step(t))
+}
+
+// Verify checks code against the steps around t. Steps at or before
+// lastStep are refused so a code can't be replayed; on success the matched
+// step is returned for the caller to store as the new lastStep.
+func (c TOTPConfig) Verify(secret []byte, code string, t time.Time, lastStep int64) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != c.Digits {
+		return 0, false
+	}
+
+	now := c.step(t)
+	for s := now - c.Skew; s <= now+c.Skew; s++ {
+		if s <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(c.codeAt(secret, s)), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// URI builds the otpauth:// link that gets rendered as a QR code, see
+// https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func (c TOTPConfig) URI(issuer, account string, secret []byte) string {
+	q := url.Values{}
+	q.Set("secret", EncodeTOTPSecret(secret))
+	q.Set("issuer", issuer)
+	q.Set("algorithm", c.Algorithm)
+	q.Set("digits", fmt.Sprint(c.Digits))
+	q.Set("period", fmt.Sprint(int(c.Period/time.Second)))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+// GenerateRecoveryCodes returns n single-use codes like "k3j9x-p2m7q" for
+// when the user loses their authenticator.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+	codes := make([]string, n)
+	buf := make([]byte, 10)
+	for i := range codes {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		var sb strings.Builder
+		for j, b := range buf {
+			if j == 5 {
+				sb.WriteByte('-')
+			}
+			sb.WriteByte(alphabet[int(b)%len(alphabet)])
+		}
+		codes[i] = sb.String()
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode normalises what the user typed (case, dashes, spaces)
+// before hashing, so "K3J9X P2M7Q" matches "k3j9x-p2m7q".
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
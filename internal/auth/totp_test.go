@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238 appendix B.
+func TestTOTPCodeRFC6238(t *testing.T) {
+	secrets := map[string][]byte{
+		"SHA1":   []byte("12345678901234567890"),
+		"SHA256": []byte("12345678901234567890123456789012"),
+		"SHA512": []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+
+	tests := []struct {
+		unix int64
+		want map[string]string
+	}{
+		{59, map[string]string{"SHA1": "94287082", "SHA256": "46119246", "SHA512": "90693936"}},
+		{1111111109, map[string]string{"SHA1": "07081804", "SHA256": "68084774", "SHA512": "25091201"}},
+		{1111111111, map[string]string{"SHA1": "14050471", "SHA256": "67062674", "SHA512": "99943326"}},
+		{1234567890, map[string]string{"SHA1": "89005924", "SHA256": "91819424", "SHA512": "93441116"}},
+		{2000000000, map[string]string{"SHA1": "69279037", "SHA256": "90698825", "SHA512": "38618901"}},
+		{20000000000, map[string]string{"SHA1": "65353130", "SHA256": "77737706", "SHA512": "47863826"}},
+	}
+
+	for _, tt := range tests {
+		for alg, want := range tt.want {
+			c := TOTPConfig{Digits: 8, Period: 30 * time.Second, Algorithm: alg}
+			if got := c.Code(secrets[alg], time.Unix(tt.unix, 0)); got != want {
+				t.Errorf("Code(%s, %d) = %s, want %s", alg, tt.unix, got, want)
+			}
+		}
+	}
+}
+
+func TestTOTPVerify(t *testing.T) {
+	c := DefaultTOTPConfig
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111111, 0)
+	nowStep := now.Unix() / 30
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantOk   bool
+	}{
+		{name: "Current code", code: c.Code(secret, now), wantOk: true},
+		{name: "Previous period within skew", code: c.Code(secret, now.Add(-30*time.Second)), wantOk: true},
+		{name: "Two periods ago", code: c.Code(secret, now.Add(-60*time.Second)), wantOk: false},
+		{name: "Replayed code", code: c.Code(secret, now), lastStep: nowStep, wantOk: false},
+		{name: "Wrong length", code: "123", wantOk: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := c.Verify(secret, tt.code, now, tt.lastStep)
+			if ok != tt.wantOk {
+				t.Errorf("Verify() ok = %v, want %v", ok, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestTOTPSecretAndURI(t *testing.T) {
+	secret, _ := GenerateTOTPSecret()
+	decoded, err := DecodeTOTPSecret(EncodeTOTPSecret(secret))
+	if err != nil || string(decoded) != string(secret) {
+		t.Fatalf("DecodeTOTPSecret(EncodeTOTPSecret()) = %x, %v, want %x", decoded, err, secret)
+	}
+
+	uri := DefaultTOTPConfig.URI("Chirpy", "user@example.com", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:user@example.com?") || !strings.Contains(uri, "secret="+EncodeTOTPSecret(secret)) {
+		t.Errorf("URI() = %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil || len(codes) != 10 {
+		t.Fatalf("GenerateRecoveryCodes() = %v, %v", codes, err)
+	}
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))) {
+		t.Errorf("HashRecoveryCode() is not normalising input")
+	}
+}
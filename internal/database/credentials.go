@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// RevokeAllCredentials takes away every way into userID's account short of
+// its password: login sessions, personal access tokens, OAuth grants, and
+// the second factor with its recovery codes. It's for when the account
+// changes hands, so run it in the same transaction as the takeover.
+//
+// Revoked sessions' access tokens still need a revocation event, see
+// auth.RevocationList; PATs and OAuth tokens are checked against the
+// database on every request.
+func (q *Queries) RevokeAllCredentials(ctx context.Context, userID uuid.UUID) error {
+	return runSteps(ctx, userID,
+		q.RevokeAllSessions,
+		q.RevokeIssuedTokens,
+		q.DeleteRecoveryCodes,
+		q.DeleteUserTOTP,
+	)
+}
+
+// RevokeIssuedTokens revokes the personal access tokens userID created and
+// the OAuth grants they gave. Both outlive a password change, so anyone who
+// got in with the old password could use them to keep access.
+func (q *Queries) RevokeIssuedTokens(ctx context.Context, userID uuid.UUID) error {
+	return runSteps(ctx, userID,
+		q.RevokeAllPersonalAccessTokens,
+		q.RevokeAllOAuthGrants,
+	)
+}
+
+func runSteps(ctx context.Context, userID uuid.UUID, steps ...func(context.Context, uuid.UUID) error) error {
+	for _, step := range steps {
+		if err := step(ctx, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
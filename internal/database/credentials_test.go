@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// recordingDB remembers the statements it's asked to run and can fail the
+// one that touches a given table.
+type recordingDB struct {
+	DBTX
+	failOn string
+	execs  []string
+	args   [][]interface{}
+}
+
+func (db *recordingDB) ExecContext(_ context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if db.failOn != "" && strings.Contains(query, db.failOn) {
+		return nil, errors.New("boom")
+	}
+	db.execs = append(db.execs, query)
+	db.args = append(db.args, args)
+	return nil, nil
+}
+
+func TestRevokeCredentials(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name      string
+		revoke    func(q *Queries) func(context.Context, uuid.UUID) error
+		tables    []string
+		untouched []string
+	}{
+		{
+			name:   "all",
+			revoke: func(q *Queries) func(context.Context, uuid.UUID) error { return q.RevokeAllCredentials },
+			tables: []string{"refresh_tokens", "personal_access_tokens", "oauth_grants", "recovery_codes", "user_totp"},
+		},
+		{
+			name:      "issued tokens",
+			revoke:    func(q *Queries) func(context.Context, uuid.UUID) error { return q.RevokeIssuedTokens },
+			tables:    []string{"personal_access_tokens", "oauth_grants"},
+			untouched: []string{"refresh_tokens", "recovery_codes", "user_totp"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &recordingDB{}
+			if err := tt.revoke(New(db))(context.Background(), userID); err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			for _, table := range tt.tables {
+				i := -1
+				for j, q := range db.execs {
+					if strings.Contains(q, table) {
+						i = j
+					}
+				}
+				if i < 0 {
+					t.Errorf("%s not touched", table)
+					continue
+				}
+				if len(db.args[i]) != 1 || db.args[i][0] != userID {
+					t.Errorf("%s: args = %v, want [%v]", table, db.args[i], userID)
+				}
+			}
+			for _, table := range tt.untouched {
+				for _, q := range db.execs {
+					if strings.Contains(q, table) {
+						t.Errorf("%s touched", table)
+					}
+				}
+			}
+
+			failing := &recordingDB{failOn: "oauth_grants"}
+			if err := tt.revoke(New(failing))(context.Background(), userID); err == nil {
+				t.Errorf("err = nil, want the failed step's error")
+			}
+		})
+	}
+}
@@ -7,68 +7,225 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
 INSERT INTO refresh_tokens (
-    token,
+    id,
+    token_hash,
     created_at,
     updated_at,
     expires_at,
     revoked_at,
-    user_id
+    user_id,
+    user_agent,
+    ip_address,
+    last_used_at
 ) VALUES (
+    gen_random_uuid(),
     $1,
     NOW(),
     NOW(),
     NOW() + INTERVAL '60 days',
     NULL,
-    $2
+    $2,
+    $3,
+    $4,
+    NOW()
 )
-RETURNING token, created_at, updated_at, expires_at, revoked_at, user_id
+RETURNING created_at, updated_at, expires_at, revoked_at, user_id, id, token_hash, user_agent, ip_address, last_used_at
 `
 
 type CreateRefreshTokenParams struct {
-	Token  string
-	UserID uuid.UUID
+	TokenHash string
+	UserID    uuid.UUID
+	UserAgent string
+	IpAddress string
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createRefreshToken,
+		arg.TokenHash,
+		arg.UserID,
+		arg.UserAgent,
+		arg.IpAddress,
+	)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.ExpiresAt,
 		&i.RevokedAt,
 		&i.UserID,
+		&i.ID,
+		&i.TokenHash,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
 
-const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
-SELECT 
-    users.id AS user_id,  
-    users.email AS user_email
-FROM users
-INNER JOIN refresh_tokens on users.id = refresh_tokens.user_id
+const listRevokedSessionIDs = `-- name: ListRevokedSessionIDs :many
+SELECT id FROM refresh_tokens
+WHERE revoked_at > $1
+`
+
+func (q *Queries) ListRevokedSessionIDs(ctx context.Context, revokedAt sql.NullTime) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, listRevokedSessionIDs, revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSessions = `-- name: ListSessions :many
+SELECT created_at, updated_at, expires_at, revoked_at, user_id, id, token_hash, user_agent, ip_address, last_used_at FROM refresh_tokens
 WHERE
-    refresh_tokens.token = $1
-    AND (refresh_tokens.expires_at > NOW())
-    AND (refresh_tokens.revoked_at IS NULL)
+    user_id = $1
+    AND (expires_at > NOW())
+    AND (revoked_at IS NULL)
+ORDER BY last_used_at DESC
 `
 
-type GetUserFromRefreshTokenRow struct {
-	UserID    uuid.UUID
-	UserEmail string
+func (q *Queries) ListSessions(ctx context.Context, userID uuid.UUID) ([]RefreshToken, error) {
+	rows, err := q.db.QueryContext(ctx, listSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RefreshToken
+	for rows.Next() {
+		var i RefreshToken
+		if err := rows.Scan(
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.UserID,
+			&i.ID,
+			&i.TokenHash,
+			&i.UserAgent,
+			&i.IpAddress,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeRefreshTokens = `-- name: PurgeRefreshTokens :execrows
+DELETE FROM refresh_tokens
+WHERE expires_at < NOW() OR revoked_at < $1
+`
+
+func (q *Queries) PurgeRefreshTokens(ctx context.Context, revokedAt sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeRefreshTokens, revokedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeAllSessions = `-- name: RevokeAllSessions :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAllSessions(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllSessions, userID)
+	return err
+}
+
+const revokeOtherSessions = `-- name: RevokeOtherSessions :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+`
+
+type RevokeOtherSessionsParams struct {
+	UserID uuid.UUID
+	ID     uuid.UUID
+}
+
+func (q *Queries) RevokeOtherSessions(ctx context.Context, arg RevokeOtherSessionsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeOtherSessions, arg.UserID, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeSession = `-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeSessionParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeSession, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const useRefreshToken = `-- name: UseRefreshToken :one
+UPDATE refresh_tokens
+SET last_used_at = NOW(), user_agent = $2, ip_address = $3
+WHERE
+    token_hash = $1
+    AND (expires_at > NOW())
+    AND (revoked_at IS NULL)
+RETURNING id, user_id
+`
+
+type UseRefreshTokenParams struct {
+	TokenHash string
+	UserAgent string
+	IpAddress string
+}
+
+type UseRefreshTokenRow struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
 }
 
-func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (GetUserFromRefreshTokenRow, error) {
-	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, token)
-	var i GetUserFromRefreshTokenRow
-	err := row.Scan(&i.UserID, &i.UserEmail)
+func (q *Queries) UseRefreshToken(ctx context.Context, arg UseRefreshTokenParams) (UseRefreshTokenRow, error) {
+	row := q.db.QueryRowContext(ctx, useRefreshToken, arg.TokenHash, arg.UserAgent, arg.IpAddress)
+	var i UseRefreshTokenRow
+	err := row.Scan(&i.ID, &i.UserID)
 	return i, err
 }
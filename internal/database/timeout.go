@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrQueryTimeout means a single query ran past TimeoutDB.Timeout while the
+// request it belonged to still had time left, i.e. the database is slow
+// rather than the request being too big.
+var ErrQueryTimeout = errors.New("query timed out")
+
+// QueryStats counts queries that ended because their context did.
+type QueryStats struct {
+	TimedOut atomic.Int64
+	Canceled atomic.Int64
+}
+
+// TimeoutDB is a DBTX that bounds every query by Timeout, on top of any
+// deadline the caller's context already carries, and records queries cut
+// short by their context in Stats.
+type TimeoutDB struct {
+	DB      DBTX
+	Timeout time.Duration
+	Stats   *QueryStats
+}
+
+func (t *TimeoutDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	qctx, cancel := t.withTimeout(ctx)
+	defer cancel()
+
+	res, err := t.DB.ExecContext(qctx, query, args...)
+	return res, qctx.check(err)
+}
+
+func (t *TimeoutDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	qctx, cancel := t.withTimeout(ctx)
+	defer cancel()
+
+	stmt, err := t.DB.PrepareContext(qctx, query)
+	return stmt, qctx.check(err)
+}
+
+func (t *TimeoutDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	// the rows are read after we return and die with their context, so
+	// it can't be cancelled here; it's released when it expires instead.
+	// Errors while reading still come out classified, see queryContext.
+	qctx, cancel := t.withTimeout(ctx)
+	context.AfterFunc(qctx, cancel)
+
+	rows, err := t.DB.QueryContext(qctx, query, args...)
+	return rows, qctx.check(err)
+}
+
+func (t *TimeoutDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	// same as QueryContext: Scan happens after we return, and is where a
+	// slow query usually runs out of time
+	qctx, cancel := t.withTimeout(ctx)
+	context.AfterFunc(qctx, cancel)
+
+	row := t.DB.QueryRowContext(qctx, query, args...)
+	qctx.check(row.Err())
+	return row
+}
+
+func (t *TimeoutDB) withTimeout(ctx context.Context) (*queryContext, context.CancelFunc) {
+	qctx, cancel := ctx, context.CancelFunc(func() {})
+	if t.Timeout > 0 {
+		qctx, cancel = context.WithTimeout(ctx, t.Timeout)
+	}
+	return &queryContext{Context: qctx, parent: ctx, stats: t.Stats}, cancel
+}
+
+// queryContext is what a query runs under. Once it has ended, Err says which
+// context did: ours (ErrQueryTimeout) or the caller's (its ctx.Err()), and
+// counts the query in stats the first time it's asked. database/sql hands
+// Err back from Next and Scan when the context ends mid-read, so a query cut
+// short after QueryContext or QueryRowContext returned is classified and
+// counted the same as one cut short before.
+type queryContext struct {
+	context.Context
+	parent context.Context
+	stats  *QueryStats
+
+	once sync.Once
+	err  error
+}
+
+func (c *queryContext) Err() error {
+	err := c.Context.Err()
+	if err == nil {
+		return nil
+	}
+
+	c.once.Do(func() {
+		cause := c.parent.Err()
+		if cause == nil {
+			cause = ErrQueryTimeout
+		}
+
+		if c.stats != nil {
+			if errors.Is(cause, context.Canceled) {
+				c.stats.Canceled.Add(1)
+			} else {
+				c.stats.TimedOut.Add(1)
+			}
+		}
+
+		c.err = err
+		if !errors.Is(err, cause) {
+			c.err = fmt.Errorf("%w: %w", cause, err)
+		}
+	})
+	return c.err
+}
+
+// check classifies err if it came from the query's context ending, e.g. as
+// Postgres' query_canceled rather than a context error.
+func (c *queryContext) check(err error) error {
+	if err == nil {
+		return nil
+	}
+	ctxErr := c.Err()
+	switch {
+	case ctxErr == nil || errors.Is(err, ctxErr):
+		return err
+	case errors.Is(err, c.Context.Err()):
+		// the bare context error, from something that didn't ask us
+		return ctxErr
+	}
+	return fmt.Errorf("%w: %w", ctxErr, err)
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+// slowDB never answers; every call waits for its context to end.
+type slowDB struct{ DBTX }
+
+func (slowDB) ExecContext(ctx context.Context, _ string, _ ...interface{}) (sql.Result, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// slowDriver answers queries at once but never sends a row, like Postgres
+// still working on one, so the wait happens while the rows are read.
+type slowDriver struct{}
+
+func (slowDriver) Open(string) (driver.Conn, error) { return slowConn{}, nil }
+
+type slowConn struct{}
+
+func (slowConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (slowConn) Close() error                        { return nil }
+func (slowConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (slowConn) QueryContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	return slowRows{ctx}, nil
+}
+
+type slowRows struct{ ctx context.Context }
+
+func (slowRows) Columns() []string { return []string{"n"} }
+func (slowRows) Close() error      { return nil }
+
+func (r slowRows) Next([]driver.Value) error {
+	<-r.ctx.Done()
+	return r.ctx.Err()
+}
+
+func init() {
+	sql.Register("slow", slowDriver{})
+}
+
+var timeoutCases = []struct {
+	name         string
+	ctx          func() (context.Context, context.CancelFunc)
+	wantErr      error
+	wantTimedOut int64
+	wantCanceled int64
+}{
+	{
+		name:         "Query timeout",
+		ctx:          func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) },
+		wantErr:      ErrQueryTimeout,
+		wantTimedOut: 1,
+	},
+	{
+		name: "Request deadline first",
+		ctx: func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), time.Millisecond)
+		},
+		wantErr:      context.DeadlineExceeded,
+		wantTimedOut: 1,
+	},
+	{
+		name: "Client went away",
+		ctx: func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx, cancel
+		},
+		wantErr:      context.Canceled,
+		wantCanceled: 1,
+	},
+}
+
+func TestTimeoutDBWhileReading(t *testing.T) {
+	sqlDB, err := sql.Open("slow", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	reads := []struct {
+		name string
+		read func(ctx context.Context, db *TimeoutDB) error
+	}{
+		{"QueryRowContext", func(ctx context.Context, db *TimeoutDB) error {
+			var n int
+			return db.QueryRowContext(ctx, "SELECT pg_sleep(10)").Scan(&n)
+		}},
+		{"QueryContext", func(ctx context.Context, db *TimeoutDB) error {
+			rows, err := db.QueryContext(ctx, "SELECT pg_sleep(10)")
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+			}
+			return rows.Err()
+		}},
+	}
+
+	for _, r := range reads {
+		for _, tt := range timeoutCases {
+			t.Run(r.name+"/"+tt.name, func(t *testing.T) {
+				stats := &QueryStats{}
+				db := &TimeoutDB{DB: sqlDB, Timeout: 20 * time.Millisecond, Stats: stats}
+
+				ctx, cancel := tt.ctx()
+				defer cancel()
+
+				err := r.read(ctx, db)
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				}
+				if got := stats.TimedOut.Load(); got != tt.wantTimedOut {
+					t.Errorf("TimedOut = %d, want %d", got, tt.wantTimedOut)
+				}
+				if got := stats.Canceled.Load(); got != tt.wantCanceled {
+					t.Errorf("Canceled = %d, want %d", got, tt.wantCanceled)
+				}
+			})
+		}
+	}
+}
+
+func TestTimeoutDB(t *testing.T) {
+	for _, tt := range timeoutCases {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := &QueryStats{}
+			db := &TimeoutDB{DB: slowDB{}, Timeout: 20 * time.Millisecond, Stats: stats}
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			_, err := db.ExecContext(ctx, "SELECT pg_sleep(10)")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ExecContext() err = %v, want %v", err, tt.wantErr)
+			}
+			if got := stats.TimedOut.Load(); got != tt.wantTimedOut {
+				t.Errorf("TimedOut = %d, want %d", got, tt.wantTimedOut)
+			}
+			if got := stats.Canceled.Load(); got != tt.wantCanceled {
+				t.Errorf("Canceled = %d, want %d", got, tt.wantCanceled)
+			}
+		})
+	}
+}
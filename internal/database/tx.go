@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// txMaxAttempts bounds how often InTx re-runs a transaction that lost a
+// serialization conflict.
+const txMaxAttempts = 3
+
+// TxRunner runs units of work in a transaction. Queries inside get the same
+// per-query timeout as outside, see TimeoutDB.
+type TxRunner struct {
+	DB      *sql.DB
+	Timeout time.Duration
+	Stats   *QueryStats
+}
+
+// InTx runs fn in a SERIALIZABLE transaction, committing if it returns nil
+// and rolling back otherwise. When Postgres aborts it for a serialization
+// failure or deadlock, the whole of fn runs again in a new transaction, so
+// fn must not have side effects outside the database (send email etc. after
+// InTx returns).
+func (r *TxRunner) InTx(ctx context.Context, fn func(q *Queries) error) error {
+	for attempt := 1; ; attempt++ {
+		err := r.run(ctx, fn)
+		if err == nil || attempt == txMaxAttempts || !IsSerializationFailure(err) {
+			return err
+		}
+
+		// jitter so the transactions that collided don't collide again
+		delay := time.Duration(attempt)*10*time.Millisecond + rand.N(10*time.Millisecond)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (r *TxRunner) run(ctx context.Context, fn func(q *Queries) error) error {
+	tx, err := r.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	// no-op after Commit; covers errors and panics in fn
+	defer tx.Rollback()
+
+	if err := fn(New(&TimeoutDB{DB: tx, Timeout: r.Timeout, Stats: r.Stats})); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IsSerializationFailure reports whether err is Postgres giving up on a
+// transaction because of concurrent ones; retrying it is expected to work.
+func IsSerializationFailure(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	// serialization_failure, deadlock_detected
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
+
+// IsUniqueViolation reports whether err is a write that clashed with a
+// unique constraint, e.g. an email another account already has.
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
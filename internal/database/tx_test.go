@@ -0,0 +1,54 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestIsSerializationFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Serialization failure", &pq.Error{Code: "40001"}, true},
+		{"Deadlock", &pq.Error{Code: "40P01"}, true},
+		{"Wrapped", fmt.Errorf("create session: %w", &pq.Error{Code: "40001"}), true},
+		{"Unique violation", &pq.Error{Code: "23505"}, false},
+		{"Not a pq error", errors.New("boom"), false},
+		{"Nil", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsSerializationFailure(tt.err); got != tt.want {
+				t.Errorf("IsSerializationFailure(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Unique violation", &pq.Error{Code: "23505"}, true},
+		{"Wrapped", fmt.Errorf("update user: %w", &pq.Error{Code: "23505"}), true},
+		{"Serialization failure", &pq.Error{Code: "40001"}, false},
+		{"Not a pq error", errors.New("boom"), false},
+		{"Nil", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsUniqueViolation(tt.err); got != tt.want {
+				t.Errorf("IsUniqueViolation(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
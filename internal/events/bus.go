@@ -0,0 +1,105 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"slices"
+	"sync"
+)
+
+// Event is a domain event: something that happened that other parts of the
+// app, on this instance or (with PostgresBus) on every instance, may care
+// about.
+type Event struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// New builds an event with data marshalled to JSON.
+func New(typ string, data any) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Type: typ, Data: raw}, nil
+}
+
+// Handler reacts to an event. It runs on the bus's delivering goroutine, so
+// it must be quick and must not block; hand anything slow off elsewhere.
+type Handler func(Event)
+
+type Bus interface {
+	// Publish announces e to every subscriber.
+	Publish(ctx context.Context, e Event) error
+	// Subscribe calls h for events of the given types, or all events when
+	// none are given, until the returned function is called.
+	Subscribe(h Handler, types ...string) (unsubscribe func())
+}
+
+type subscription struct {
+	h     Handler
+	types []string
+}
+
+// handlers is the local fan-out every Bus implementation ends in.
+type handlers struct {
+	mu   sync.RWMutex
+	next int
+	subs map[int]subscription
+}
+
+func (hs *handlers) Subscribe(h Handler, types ...string) func() {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	if hs.subs == nil {
+		hs.subs = map[int]subscription{}
+	}
+	id := hs.next
+	hs.next++
+	hs.subs[id] = subscription{h: h, types: types}
+
+	return func() {
+		hs.mu.Lock()
+		defer hs.mu.Unlock()
+		delete(hs.subs, id)
+	}
+}
+
+func (hs *handlers) dispatch(e Event) {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	for _, s := range hs.subs {
+		if len(s.types) == 0 || slices.Contains(s.types, e.Type) {
+			call(s.h, e)
+		}
+	}
+}
+
+// call runs h, keeping a panicking handler from taking the others (and the
+// publisher) down with it.
+func call(h Handler, e Event) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("event handler for %s panicked: %v", e.Type, p)
+		}
+	}()
+	h(e)
+}
+
+// MemoryBus delivers events to subscribers in this process only, straight
+// from Publish. Fine for a single instance.
+type MemoryBus struct {
+	handlers
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+func (b *MemoryBus) Publish(_ context.Context, e Event) error {
+	b.dispatch(e)
+	return nil
+}
@@ -0,0 +1,68 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var (
+	_ Bus = (*MemoryBus)(nil)
+	_ Bus = (*PostgresBus)(nil)
+)
+
+func TestMemoryBus(t *testing.T) {
+	b := NewMemoryBus()
+	ctx := context.Background()
+
+	var all, chirps []string
+	b.Subscribe(func(e Event) { all = append(all, e.Type) })
+	unsubscribe := b.Subscribe(func(e Event) { chirps = append(chirps, e.Type) }, "chirp.created", "chirp.deleted")
+	b.Subscribe(func(e Event) { panic("boom") }, "chirp.deleted")
+
+	for _, typ := range []string{"chirp.created", "user.created", "chirp.deleted"} {
+		e, err := New(typ, map[string]string{"id": "1"})
+		if err != nil {
+			t.Fatalf("New() err = %v", err)
+		}
+		if err := b.Publish(ctx, e); err != nil {
+			t.Fatalf("Publish() err = %v", err)
+		}
+	}
+	unsubscribe()
+	b.Publish(ctx, Event{Type: "chirp.created"})
+
+	if got := strings.Join(all, ","); got != "chirp.created,user.created,chirp.deleted,chirp.created" {
+		t.Errorf("catch-all subscriber got %s", got)
+	}
+	if got := strings.Join(chirps, ","); got != "chirp.created,chirp.deleted" {
+		t.Errorf("filtered subscriber got %s", got)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	e, _ := New("chirp.created", map[string]string{"body": "hello"})
+	payload, err := encode(e)
+	if err != nil {
+		t.Fatalf("encode() err = %v", err)
+	}
+	got, err := decode(payload)
+	if err != nil {
+		t.Fatalf("decode() err = %v", err)
+	}
+	if got.Type != e.Type || string(got.Data) != string(e.Data) {
+		t.Errorf("decode(encode(e)) = %+v, want %+v", got, e)
+	}
+
+	big, _ := New("chirp.created", strings.Repeat("x", maxPayload))
+	if _, err := encode(big); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("encode() of oversized event err = %v, want ErrPayloadTooLarge", err)
+	}
+
+	for _, bad := range []string{"", "not json", `{"data":{}}`} {
+		if _, err := decode(bad); err == nil {
+			t.Errorf("decode(%q) err = nil, want error", bad)
+		}
+	}
+}
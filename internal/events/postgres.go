@@ -0,0 +1,137 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// maxPayload is the most NOTIFY will carry.
+const maxPayload = 8000 - 1
+
+var ErrPayloadTooLarge = errors.New("event too large for NOTIFY")
+
+// PostgresBus carries events between instances with LISTEN/NOTIFY. Publish
+// sends a NOTIFY on the channel; Run hands every notification to the local
+// subscribers, this instance's own events included, so each instance sees
+// each event exactly once whoever published it.
+//
+// Delivery is best effort: notifications sent while the listener is
+// reconnecting are lost. Use it for things that can tolerate that, like
+// live updates, not as a record of what happened. Subscribers that can't
+// afford to miss anything catch up from the database in OnReconnect.
+type PostgresBus struct {
+	handlers
+
+	db       *sql.DB
+	channel  string
+	listener *pq.Listener
+
+	mu          sync.Mutex
+	onReconnect []func()
+}
+
+// NewPostgresBus publishes through db and listens on its own connection to
+// dsn, which lib/pq needs for the listener.
+func NewPostgresBus(db *sql.DB, dsn, channel string) (*PostgresBus, error) {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		switch ev {
+		case pq.ListenerEventDisconnected:
+			log.Printf("event bus: listener disconnected: %v", err)
+		case pq.ListenerEventReconnected:
+			log.Printf("event bus: listener reconnected, events sent in the meantime are lost")
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Printf("event bus: listener connect: %v", err)
+		}
+	})
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("listen on %s: %w", channel, err)
+	}
+
+	return &PostgresBus{db: db, channel: channel, listener: listener}, nil
+}
+
+func (b *PostgresBus) Publish(ctx context.Context, e Event) error {
+	payload, err := encode(e)
+	if err != nil {
+		return err
+	}
+	_, err = b.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", b.channel, payload)
+	return err
+}
+
+// OnReconnect registers f to be called, on a goroutine of its own, each time
+// the listener is back after losing its connection, i.e. after events may
+// have been missed.
+func (b *PostgresBus) OnReconnect(f func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onReconnect = append(b.onReconnect, f)
+}
+
+// Run delivers notifications to subscribers until ctx is done.
+func (b *PostgresBus) Run(ctx context.Context) {
+	// a connection that died quietly is only noticed when used
+	ping := time.NewTicker(time.Minute)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-b.listener.Notify:
+			// nil after a reconnect
+			if n == nil {
+				b.mu.Lock()
+				for _, f := range b.onReconnect {
+					go f()
+				}
+				b.mu.Unlock()
+				continue
+			}
+			e, err := decode(n.Extra)
+			if err != nil {
+				log.Printf("event bus: bad notification on %s: %v", n.Channel, err)
+				continue
+			}
+			b.dispatch(e)
+		case <-ping.C:
+			go b.listener.Ping()
+		}
+	}
+}
+
+// Close stops listening.
+func (b *PostgresBus) Close() error {
+	return b.listener.Close()
+}
+
+func encode(e Event) (string, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxPayload {
+		return "", fmt.Errorf("%w: %s is %d bytes", ErrPayloadTooLarge, e.Type, len(data))
+	}
+	return string(data), nil
+}
+
+func decode(payload string) (Event, error) {
+	var e Event
+	if err := json.Unmarshal([]byte(payload), &e); err != nil {
+		return Event{}, err
+	}
+	if e.Type == "" {
+		return Event{}, errors.New("event without a type")
+	}
+	return e, nil
+}
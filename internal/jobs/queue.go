@@ -0,0 +1,192 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharath070/Chirpy/internal/database"
+)
+
+// DefaultMaxAttempts is how often a queued job runs before it's marked
+// failed, unless Enqueue is told otherwise.
+const DefaultMaxAttempts = 5
+
+// Handler does the work for one kind of queued job.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// Store is the part of database.Queries the queue needs.
+type Store interface {
+	EnqueueJob(ctx context.Context, arg database.EnqueueJobParams) (database.Job, error)
+	ClaimJob(ctx context.Context) (database.Job, error)
+	CompleteJob(ctx context.Context, id uuid.UUID) error
+	RetryJob(ctx context.Context, arg database.RetryJobParams) error
+	FailJob(ctx context.Context, arg database.FailJobParams) error
+	RequeueStaleJobs(ctx context.Context, lockedAt sql.NullTime) (int64, error)
+}
+
+// Queue is a job queue kept in the jobs table. Workers on every instance
+// claim jobs with SELECT ... FOR UPDATE SKIP LOCKED, so each job runs on one
+// of them at a time; failed runs are retried with Backoff until the job runs
+// out of attempts.
+type Queue struct {
+	// PollInterval is how long an idle worker waits before looking again.
+	PollInterval time.Duration
+	// Lease is how long a claimed job may run. Jobs held longer, usually by
+	// an instance that died, go back to pending in RequeueStale, or fail if
+	// they were on their last attempt.
+	Lease time.Duration
+
+	store Store
+	now   func() time.Time
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+func NewQueue(store Store) *Queue {
+	return &Queue{
+		PollInterval: time.Second,
+		Lease:        10 * time.Minute,
+		store:        store,
+		now:          time.Now,
+		handlers:     map[string]Handler{},
+	}
+}
+
+// Handle registers h for jobs of kind.
+func (q *Queue) Handle(kind string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = h
+}
+
+// Enqueue adds a job of kind with payload marshalled to JSON, to run as soon
+// as a worker is free.
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload any) (uuid.UUID, error) {
+	return q.EnqueueAt(ctx, kind, payload, q.now(), DefaultMaxAttempts)
+}
+
+// EnqueueAt adds a job that runs no earlier than runAt, at most maxAttempts
+// times.
+func (q *Queue) EnqueueAt(ctx context.Context, kind string, payload any, runAt time.Time, maxAttempts int) (uuid.UUID, error) {
+	return q.EnqueueWith(ctx, q.store, kind, payload, runAt, maxAttempts)
+}
+
+// EnqueueWith is EnqueueAt through s, typically the Queries of a
+// transaction, so the job exists only if the transaction commits.
+func (q *Queue) EnqueueWith(ctx context.Context, s Store, kind string, payload any, runAt time.Time, maxAttempts int) (uuid.UUID, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("jobs: marshal %s payload: %w", kind, err)
+	}
+
+	job, err := s.EnqueueJob(ctx, database.EnqueueJobParams{
+		Kind:        kind,
+		Payload:     data,
+		MaxAttempts: int32(maxAttempts),
+		RunAt:       runAt,
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return job.ID, nil
+}
+
+// Work runs queued jobs one after the other until ctx is done. Start one
+// goroutine per worker wanted.
+func (q *Queue) Work(ctx context.Context) {
+	for {
+		ran, err := q.RunOne(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("job queue: %v", err)
+		}
+		if ran {
+			continue
+		}
+
+		timer := time.NewTimer(q.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// RunOne claims and runs a single due job. It reports whether there was one;
+// the error is about the queue itself, job failures are recorded on the job.
+func (q *Queue) RunOne(ctx context.Context) (bool, error) {
+	job, err := q.store.ClaimJob(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	q.mu.RLock()
+	h, ok := q.handlers[job.Kind]
+	q.mu.RUnlock()
+
+	if !ok {
+		// no retry will make a handler appear
+		return true, q.store.FailJob(ctx, database.FailJobParams{
+			ID:        job.ID,
+			LastError: sql.NullString{String: "no handler for job kind " + job.Kind, Valid: true},
+		})
+	}
+
+	jobErr := q.call(ctx, h, job.Payload)
+	switch {
+	case jobErr == nil:
+		return true, q.store.CompleteJob(ctx, job.ID)
+	case job.Attempts < job.MaxAttempts:
+		log.Printf("job %s (%s) attempt %d failed: %v", job.ID, job.Kind, job.Attempts, jobErr)
+		return true, q.store.RetryJob(ctx, database.RetryJobParams{
+			ID:        job.ID,
+			RunAt:     q.now().Add(Backoff(int(job.Attempts))),
+			LastError: sql.NullString{String: jobErr.Error(), Valid: true},
+		})
+	default:
+		log.Printf("job %s (%s) failed for good after %d attempts: %v", job.ID, job.Kind, job.Attempts, jobErr)
+		return true, q.store.FailJob(ctx, database.FailJobParams{
+			ID:        job.ID,
+			LastError: sql.NullString{String: jobErr.Error(), Valid: true},
+		})
+	}
+}
+
+func (q *Queue) call(ctx context.Context, h Handler, payload json.RawMessage) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, q.Lease)
+	defer cancel()
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return h(ctx, payload)
+}
+
+// RequeueStale puts jobs whose lease ran out back to pending, or fails them
+// if that was their last attempt, so a job that keeps crashing or hanging
+// its worker isn't picked up forever. It fits the Func signature so it can
+// run on a Scheduler.
+func (q *Queue) RequeueStale(ctx context.Context) error {
+	n, err := q.store.RequeueStaleJobs(ctx, sql.NullTime{Time: q.now().Add(-q.Lease), Valid: true})
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("job queue: requeued or failed %d jobs whose lease ran out", n)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharath070/Chirpy/internal/database"
+)
+
+// fakeStore hands out a single job and remembers what happened to it.
+type fakeStore struct {
+	job     *database.Job
+	outcome string
+	runAt   time.Time
+	lastErr string
+}
+
+func (s *fakeStore) EnqueueJob(_ context.Context, arg database.EnqueueJobParams) (database.Job, error) {
+	s.job = &database.Job{
+		ID:          uuid.New(),
+		Kind:        arg.Kind,
+		Payload:     arg.Payload,
+		Status:      "pending",
+		MaxAttempts: arg.MaxAttempts,
+		RunAt:       arg.RunAt,
+	}
+	return *s.job, nil
+}
+
+func (s *fakeStore) ClaimJob(context.Context) (database.Job, error) {
+	if s.job == nil || s.job.Status != "pending" {
+		return database.Job{}, sql.ErrNoRows
+	}
+	s.job.Status = "running"
+	s.job.Attempts++
+	return *s.job, nil
+}
+
+func (s *fakeStore) CompleteJob(context.Context, uuid.UUID) error {
+	s.job.Status, s.outcome = "done", "done"
+	return nil
+}
+
+func (s *fakeStore) RetryJob(_ context.Context, arg database.RetryJobParams) error {
+	s.job.Status, s.outcome = "pending", "retry"
+	s.runAt, s.lastErr = arg.RunAt, arg.LastError.String
+	return nil
+}
+
+func (s *fakeStore) FailJob(_ context.Context, arg database.FailJobParams) error {
+	s.job.Status, s.outcome = "failed", "failed"
+	s.lastErr = arg.LastError.String
+	return nil
+}
+
+func (s *fakeStore) RequeueStaleJobs(context.Context, sql.NullTime) (int64, error) {
+	return 0, nil
+}
+
+func TestQueueRunOne(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	errFlaky := errors.New("receiver down")
+
+	tests := []struct {
+		name        string
+		kind        string
+		maxAttempts int
+		handler     Handler
+		wantOutcome string
+		wantErr     string
+	}{
+		{
+			name:        "Success",
+			kind:        "greet",
+			maxAttempts: 3,
+			handler:     func(context.Context, json.RawMessage) error { return nil },
+			wantOutcome: "done",
+		},
+		{
+			name:        "Failure with attempts left",
+			kind:        "greet",
+			maxAttempts: 3,
+			handler:     func(context.Context, json.RawMessage) error { return errFlaky },
+			wantOutcome: "retry",
+			wantErr:     errFlaky.Error(),
+		},
+		{
+			name:        "Failure on last attempt",
+			kind:        "greet",
+			maxAttempts: 1,
+			handler:     func(context.Context, json.RawMessage) error { return errFlaky },
+			wantOutcome: "failed",
+			wantErr:     errFlaky.Error(),
+		},
+		{
+			name:        "Panic",
+			kind:        "greet",
+			maxAttempts: 1,
+			handler:     func(context.Context, json.RawMessage) error { panic("boom") },
+			wantOutcome: "failed",
+			wantErr:     "panic: boom",
+		},
+		{
+			name:        "Unknown kind",
+			kind:        "mystery",
+			maxAttempts: 3,
+			wantOutcome: "failed",
+			wantErr:     "no handler for job kind mystery",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{}
+			q := NewQueue(store)
+			q.now = func() time.Time { return now }
+			if tt.handler != nil {
+				q.Handle("greet", tt.handler)
+			}
+
+			ctx := context.Background()
+			if _, err := q.EnqueueAt(ctx, tt.kind, map[string]string{"to": "world"}, now, tt.maxAttempts); err != nil {
+				t.Fatalf("EnqueueAt() err = %v", err)
+			}
+
+			ran, err := q.RunOne(ctx)
+			if !ran || err != nil {
+				t.Fatalf("RunOne() = %v, %v, want true, nil", ran, err)
+			}
+			if store.outcome != tt.wantOutcome || store.lastErr != tt.wantErr {
+				t.Errorf("job ended %q with error %q, want %q with %q", store.outcome, store.lastErr, tt.wantOutcome, tt.wantErr)
+			}
+			if tt.wantOutcome == "retry" && !store.runAt.Equal(now.Add(Backoff(1))) {
+				t.Errorf("retry at %v, want %v", store.runAt, now.Add(Backoff(1)))
+			}
+
+			ran, err = q.RunOne(ctx)
+			if ran != (tt.wantOutcome == "retry") || err != nil {
+				t.Errorf("second RunOne() = %v, %v", ran, err)
+			}
+		})
+	}
+}
+
+func TestQueuePayload(t *testing.T) {
+	store := &fakeStore{}
+	q := NewQueue(store)
+
+	var got struct{ To string }
+	q.Handle("greet", func(_ context.Context, payload json.RawMessage) error {
+		return json.Unmarshal(payload, &got)
+	})
+
+	ctx := context.Background()
+	if _, err := q.Enqueue(ctx, "greet", map[string]string{"to": "world"}); err != nil {
+		t.Fatalf("Enqueue() err = %v", err)
+	}
+	if store.job.MaxAttempts != DefaultMaxAttempts {
+		t.Errorf("MaxAttempts = %d, want %d", store.job.MaxAttempts, DefaultMaxAttempts)
+	}
+	if _, err := q.RunOne(ctx); err != nil {
+		t.Fatalf("RunOne() err = %v", err)
+	}
+	if got.To != "world" {
+		t.Errorf("handler got payload %+v, want To=world", got)
+	}
+
+	if _, err := q.Enqueue(ctx, "greet", func() {}); err == nil {
+		t.Errorf("Enqueue() with unmarshalable payload err = nil, want error")
+	}
+}
+
+func TestQueueEnqueueWith(t *testing.T) {
+	store, tx := &fakeStore{}, &fakeStore{}
+	q := NewQueue(store)
+
+	runAt := time.Now().Add(time.Minute)
+	id, err := q.EnqueueWith(context.Background(), tx, "greet", nil, runAt, 2)
+	if err != nil {
+		t.Fatalf("EnqueueWith() err = %v", err)
+	}
+	if store.job != nil {
+		t.Errorf("job went to the queue's own store")
+	}
+	if tx.job == nil || tx.job.ID != id || tx.job.MaxAttempts != 2 || !tx.job.RunAt.Equal(runAt) {
+		t.Errorf("job in given store = %+v", tx.job)
+	}
+}
@@ -0,0 +1,194 @@
+package jobs
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Func is the body of a periodic job. It should stop early when ctx is done.
+type Func func(ctx context.Context) error
+
+// Status is a periodic job's bookkeeping, as shown on the admin endpoint.
+type Status struct {
+	Name     string
+	Interval time.Duration
+	Runs     int
+	Failures int
+	// consecutive failures; while non-zero the job is retried with backoff
+	// instead of waiting a full interval
+	FailStreak   int
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastError    string
+	NextRun      time.Time
+	Running      bool
+}
+
+type periodic struct {
+	fn     Func
+	status Status
+}
+
+// Scheduler runs periodic jobs in the background of this process. Every
+// instance runs its own, so jobs must be safe to run concurrently with
+// themselves on other instances; the purges we use it for are.
+type Scheduler struct {
+	// Timeout bounds a single run of a job.
+	Timeout time.Duration
+
+	now func() time.Time
+
+	mu   sync.Mutex
+	jobs map[string]*periodic
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		Timeout: 5 * time.Minute,
+		now:     time.Now,
+		jobs:    map[string]*periodic{},
+	}
+}
+
+// Every registers fn to run every interval, the first time one interval after
+// Run starts. Register all jobs before calling Run.
+func (s *Scheduler) Every(name string, interval time.Duration, fn Func) {
+	if interval <= 0 {
+		panic(fmt.Sprintf("jobs: non-positive interval for %q", name))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[name]; ok {
+		panic(fmt.Sprintf("jobs: duplicate job %q", name))
+	}
+	s.jobs[name] = &periodic{fn: fn, status: Status{Name: name, Interval: interval}}
+}
+
+// Run starts every registered job and blocks until ctx is done and the runs
+// in flight have returned.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.jobs))
+	for name, j := range s.jobs {
+		names = append(names, name)
+		j.status.NextRun = s.now().Add(j.status.Interval)
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, name)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, name string) {
+	for {
+		s.mu.Lock()
+		wait := s.jobs[name].status.NextRun.Sub(s.now())
+		s.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.RunNow(ctx, name)
+	}
+}
+
+// RunNow runs the named job once, right away, and schedules its next run. It
+// returns the job's error, or an error if there's no such job.
+func (s *Scheduler) RunNow(ctx context.Context, name string) error {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("jobs: no job %q", name)
+	}
+	j.status.Running = true
+	s.mu.Unlock()
+
+	start := s.now()
+	err := s.call(ctx, j.fn)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := &j.status
+	st.Running = false
+	st.Runs++
+	st.LastRun = start
+	st.LastDuration = s.now().Sub(start)
+	st.LastError = ""
+	st.NextRun = s.now().Add(st.Interval)
+	if err != nil {
+		st.Failures++
+		st.FailStreak++
+		st.LastError = err.Error()
+		st.NextRun = s.now().Add(min(Backoff(st.FailStreak), st.Interval))
+		log.Printf("job %s failed (%d in a row): %v", name, st.FailStreak, err)
+	} else {
+		st.FailStreak = 0
+	}
+	return err
+}
+
+// call runs fn with the per-run timeout, turning a panic into an error so one
+// bad job doesn't take the process down.
+func (s *Scheduler) call(ctx context.Context, fn Func) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return fn(ctx)
+}
+
+// Status returns every job's status, sorted by name.
+func (s *Scheduler) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]Status, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		out = append(out, j.status)
+	}
+	slices.SortFunc(out, func(a, b Status) int { return cmp.Compare(a.Name, b.Name) })
+	return out
+}
+
+// Backoff is how long to wait before retry number attempt (1 for the first
+// retry): 10s doubling each time, capped at an hour.
+func Backoff(attempt int) time.Duration {
+	const (
+		base     = 10 * time.Second
+		maxDelay = time.Hour
+	)
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := base
+	for range attempt - 1 {
+		d *= 2
+		if d >= maxDelay {
+			return maxDelay
+		}
+	}
+	return d
+}
@@ -0,0 +1,99 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 0, want: 10 * time.Second},
+		{attempt: 1, want: 10 * time.Second},
+		{attempt: 2, want: 20 * time.Second},
+		{attempt: 4, want: 80 * time.Second},
+		{attempt: 10, want: time.Hour},
+		{attempt: 1000, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestSchedulerRunNow(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewScheduler()
+	s.now = func() time.Time { return now }
+
+	var fail error
+	s.Every("purge", time.Hour, func(ctx context.Context) error { return fail })
+	s.Every("boom", time.Hour, func(ctx context.Context) error { panic("boom") })
+
+	fail = errors.New("db down")
+	for range 2 {
+		if err := s.RunNow(context.Background(), "purge"); err == nil {
+			t.Fatalf("RunNow() err = nil, want the job's error")
+		}
+	}
+	st := s.Status()[1]
+	if st.Name != "purge" || st.Runs != 2 || st.Failures != 2 || st.FailStreak != 2 || st.LastError != "db down" {
+		t.Errorf("Status() after failures = %+v", st)
+	}
+	if want := now.Add(20 * time.Second); !st.NextRun.Equal(want) {
+		t.Errorf("NextRun after 2 failures = %v, want %v (backoff)", st.NextRun, want)
+	}
+
+	fail = nil
+	if err := s.RunNow(context.Background(), "purge"); err != nil {
+		t.Fatalf("RunNow() err = %v", err)
+	}
+	st = s.Status()[1]
+	if st.FailStreak != 0 || st.Failures != 2 || st.LastError != "" || !st.NextRun.Equal(now.Add(time.Hour)) {
+		t.Errorf("Status() after success = %+v", st)
+	}
+
+	if err := s.RunNow(context.Background(), "boom"); err == nil {
+		t.Errorf("RunNow() on panicking job err = nil, want error")
+	}
+	if err := s.RunNow(context.Background(), "nope"); err == nil {
+		t.Errorf("RunNow() on unknown job err = nil, want error")
+	}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	s := NewScheduler()
+	ran := make(chan struct{}, 10)
+	s.Every("tick", time.Millisecond, func(ctx context.Context) error {
+		ran <- struct{}{}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	for range 2 {
+		select {
+		case <-ran:
+		case <-time.After(time.Second):
+			t.Fatal("job didn't run")
+		}
+	}
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run() didn't return after ctx was cancelled")
+	}
+}
@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewLogMailer("chirpy@example.com", &buf)
+
+	err := m.Send(context.Background(), Message{
+		To:      "user@example.com",
+		Subject: "Verify your email",
+		Body:    "line one\nline two",
+	})
+	if err != nil {
+		t.Fatalf("Send() err = %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"From: chirpy@example.com\r\n", "To: user@example.com\r\n", "Subject: Verify your email\r\n", "line one\r\nline two"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Send() output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestHeaderInjection(t *testing.T) {
+	m := NewLogMailer("chirpy@example.com", &bytes.Buffer{})
+
+	err := m.Send(context.Background(), Message{
+		To:      "user@example.com\r\nBcc: everyone@example.com",
+		Subject: "hi",
+	})
+	if err == nil {
+		t.Errorf("Send() with newline in To err = nil, want error")
+	}
+}
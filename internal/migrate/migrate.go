@@ -0,0 +1,450 @@
+package migrate
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	A small runner for the goose migrations in sql/schema, so the server can
+	migrate its own database instead of someone running goose by hand first.
+
+	It reads goose's file format (-- +goose Up / Down, NO TRANSACTION) and
+	keeps goose's bookkeeping table, goose_db_version, so a database
+	migrated with the goose CLI and one migrated by us are interchangeable.
+
+	Concurrent instances starting at once serialize on a Postgres advisory
+	lock; whoever gets it second finds nothing left to do.
+*/
+
+// lockID is the advisory lock key; any constant that nothing else uses.
+const lockID = 0x636869727079 // "chirpy"
+
+const versionTable = "goose_db_version"
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// set by "-- +goose NO TRANSACTION", for statements like
+	// CREATE INDEX CONCURRENTLY that can't run inside one
+	NoTx bool
+
+	// Up and Down split into statements, NoTx only: Postgres runs several
+	// statements sent together in an implicit transaction, so they have to
+	// go one at a time
+	upStatements, downStatements []string
+}
+
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+var ErrNoMigrations = errors.New("migrate: no migrations applied")
+
+// Load reads NNN_name.sql files from the root of fsys, sorted by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, name := range names {
+		src, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		m, err := parse(name, string(src))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, m)
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("migrate: duplicate version %d in %s and %s", migrations[i].Version, migrations[i-1].Name, migrations[i].Name)
+		}
+	}
+
+	return migrations, nil
+}
+
+func parse(name, src string) (Migration, error) {
+	prefix, _, ok := strings.Cut(path.Base(name), "_")
+	version, err := strconv.ParseInt(prefix, 10, 64)
+	if !ok || err != nil || version < 1 {
+		return Migration{}, fmt.Errorf("migrate: %s: file name must start with a version number and _", name)
+	}
+
+	m := Migration{Version: version, Name: name}
+	// lines of each section, directives included for splitStatements
+	var up, down []string
+	var cur *[]string
+
+	sc := bufio.NewScanner(strings.NewReader(src))
+	for sc.Scan() {
+		line := sc.Text()
+		if directive, ok := strings.CutPrefix(strings.TrimSpace(line), "-- +goose "); ok {
+			switch strings.TrimSpace(directive) {
+			case "Up":
+				cur = &up
+				continue
+			case "Down":
+				cur = &down
+				continue
+			case "NO TRANSACTION":
+				m.NoTx = true
+				continue
+			}
+		}
+		if cur != nil {
+			*cur = append(*cur, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return Migration{}, fmt.Errorf("migrate: %s: %w", name, err)
+	}
+
+	m.Up, m.Down = joinSection(up), joinSection(down)
+	if m.Up == "" {
+		return Migration{}, fmt.Errorf("migrate: %s: no -- +goose Up section", name)
+	}
+
+	if m.NoTx {
+		if m.upStatements, err = splitStatements(up); err != nil {
+			return Migration{}, fmt.Errorf("migrate: %s up: %w", name, err)
+		}
+		if m.downStatements, err = splitStatements(down); err != nil {
+			return Migration{}, fmt.Errorf("migrate: %s down: %w", name, err)
+		}
+	}
+	return m, nil
+}
+
+// joinSection is a section as one script. Without NO TRANSACTION it's sent
+// to Postgres as a whole, so StatementBegin/End, which only matter to
+// splitStatements, are left out.
+func joinSection(lines []string) string {
+	var b strings.Builder
+	for _, line := range lines {
+		if isStatementMarker(line) {
+			continue
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func isStatementMarker(line string) bool {
+	switch strings.TrimSpace(line) {
+	case "-- +goose StatementBegin", "-- +goose StatementEnd":
+		return true
+	}
+	return false
+}
+
+// splitStatements splits a section the way goose does: a statement ends at a
+// line ending in a semicolon, unless it's between StatementBegin and
+// StatementEnd, which is for bodies with semicolons of their own.
+func splitStatements(lines []string) ([]string, error) {
+	var statements []string
+	var buf strings.Builder
+	inBlock := false
+
+	flush := func() {
+		if s := strings.TrimSpace(buf.String()); s != "" {
+			statements = append(statements, s)
+		}
+		buf.Reset()
+	}
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "-- +goose StatementBegin":
+			if inBlock {
+				return nil, errors.New("StatementBegin inside another")
+			}
+			if strings.TrimSpace(buf.String()) != "" {
+				return nil, errors.New("StatementBegin after an unterminated statement")
+			}
+			inBlock = true
+			continue
+		case trimmed == "-- +goose StatementEnd":
+			if !inBlock {
+				return nil, errors.New("StatementEnd without StatementBegin")
+			}
+			inBlock = false
+			flush()
+			continue
+		case buf.Len() == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "--")):
+			// blank lines and comments between statements
+			continue
+		}
+
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+		// a trailing comment doesn't hide the semicolon
+		code, _, _ := strings.Cut(trimmed, "--")
+		if !inBlock && strings.HasSuffix(strings.TrimSpace(code), ";") {
+			flush()
+		}
+	}
+
+	if inBlock {
+		return nil, errors.New("StatementBegin without StatementEnd")
+	}
+	if strings.TrimSpace(buf.String()) != "" {
+		return nil, errors.New("last statement doesn't end in a semicolon")
+	}
+	return statements, nil
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest is the version the embedded migrations bring the schema to.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration in order and returns what it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := run(ctx, conn, mig, true); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+	var undone Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range slices.Backward(m.migrations) {
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			undone = mig
+			return run(ctx, conn, mig, false)
+		}
+		return ErrNoMigrations
+	})
+	return undone, err
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		at, ok := applied[mig.Version]
+		statuses = append(statuses, Status{Migration: mig, Applied: ok, AppliedAt: at})
+	}
+	return statuses, nil
+}
+
+// Pending lists migrations not yet applied. A non-empty result means the
+// schema is behind the code.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// withLock runs fn on a single connection holding the advisory lock;
+// session level locks belong to the connection that took them.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return fmt.Errorf("migrate: take lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+
+	if err := ensureVersionTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func ensureVersionTable(ctx context.Context, conn *sql.Conn) error {
+	// same shape goose creates, including the version 0 row
+	_, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS `+versionTable+` (
+			id SERIAL PRIMARY KEY,
+			version_id BIGINT NOT NULL,
+			is_applied BOOLEAN NOT NULL,
+			tstamp TIMESTAMP NULL DEFAULT NOW()
+		);
+		INSERT INTO `+versionTable+` (version_id, is_applied)
+		SELECT 0, TRUE WHERE NOT EXISTS (SELECT 1 FROM `+versionTable+`);
+	`)
+	if err != nil {
+		return fmt.Errorf("migrate: create %s: %w", versionTable, err)
+	}
+	return nil
+}
+
+// appliedVersions maps each applied version to when it was applied. The
+// newest row for a version wins, as in goose; older goose versions recorded
+// rollbacks as is_applied = false rows rather than deleting.
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	// nothing has ever been migrated, and Status shouldn't create the table
+	var exists bool
+	if err := conn.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, versionTable).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("migrate: read %s: %w", versionTable, err)
+	}
+	if !exists {
+		return map[int64]time.Time{}, nil
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version_id, is_applied, tstamp FROM `+versionTable+` ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read %s: %w", versionTable, err)
+	}
+	defer rows.Close()
+
+	seen := map[int64]bool{}
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		var at sql.NullTime
+		if err := rows.Scan(&version, &isApplied, &at); err != nil {
+			return nil, err
+		}
+		if seen[version] || version == 0 {
+			continue
+		}
+		seen[version] = true
+		if isApplied {
+			applied[version] = at.Time
+		}
+	}
+	return applied, rows.Err()
+}
+
+func run(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	record := `INSERT INTO ` + versionTable + ` (version_id, is_applied) VALUES ($1, TRUE)`
+	statements, split := mig.Up, mig.upStatements
+	if !up {
+		record = `DELETE FROM ` + versionTable + ` WHERE version_id = $1`
+		statements, split = mig.Down, mig.downStatements
+	}
+
+	wrap := func(err error) error {
+		direction := "up"
+		if !up {
+			direction = "down"
+		}
+		return fmt.Errorf("migrate: %s %s: %w", mig.Name, direction, err)
+	}
+
+	if mig.NoTx {
+		// one at a time, or Postgres would wrap them in a transaction
+		for _, stmt := range split {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return wrap(err)
+			}
+		}
+		if _, err := conn.ExecContext(ctx, record, mig.Version); err != nil {
+			return wrap(err)
+		}
+		return nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return wrap(err)
+	}
+	defer tx.Rollback()
+
+	// no arguments, so lib/pq sends this as a simple query and multiple
+	// statements are fine
+	if statements != "" {
+		if _, err := tx.ExecContext(ctx, statements); err != nil {
+			return wrap(err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, mig.Version); err != nil {
+		return wrap(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return wrap(err)
+	}
+	return nil
+}
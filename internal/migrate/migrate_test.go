@@ -0,0 +1,146 @@
+package migrate
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sharath070/Chirpy/sql/schema"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_chirps.sql": {Data: []byte("-- +goose Up\nCREATE TABLE chirps (id UUID);\n\n-- +goose Down\nDROP TABLE chirps;\n")},
+		"001_users.sql":  {Data: []byte("-- +goose Up\n-- a comment stays\nCREATE TABLE users (id UUID);\n-- +goose Down\nDROP TABLE users;\n")},
+		"010_index.sql":  {Data: []byte("-- +goose NO TRANSACTION\n-- +goose Up\nCREATE INDEX CONCURRENTLY users_idx ON users (id);\n")},
+		"README.md":      {Data: []byte("not a migration")},
+	}
+
+	got, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Load() err = %v", err)
+	}
+	if len(got) != 3 || got[0].Version != 1 || got[1].Version != 2 || got[2].Version != 10 {
+		t.Fatalf("Load() versions = %v, want [1 2 10]", got)
+	}
+	if got[0].Up != "-- a comment stays\nCREATE TABLE users (id UUID);" || got[0].Down != "DROP TABLE users;" {
+		t.Errorf("Load() 001 = %q / %q", got[0].Up, got[0].Down)
+	}
+	if got[0].NoTx || !got[2].NoTx || got[2].Down != "" {
+		t.Errorf("Load() 010 = %+v, want NO TRANSACTION and no down", got[2])
+	}
+	if len(got[2].upStatements) != 1 {
+		t.Errorf("Load() 010 statements = %q, want 1", got[2].upStatements)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "One per line",
+			src:  "CREATE INDEX CONCURRENTLY a_idx ON a (id);\nCREATE INDEX CONCURRENTLY b_idx ON b (id);",
+			want: []string{"CREATE INDEX CONCURRENTLY a_idx ON a (id);", "CREATE INDEX CONCURRENTLY b_idx ON b (id);"},
+		},
+		{
+			name: "Across lines, with comments",
+			src:  "-- first\nCREATE INDEX CONCURRENTLY a_idx\n    ON a (id); -- trailing\n\n-- second\nDROP INDEX CONCURRENTLY b_idx;",
+			want: []string{"CREATE INDEX CONCURRENTLY a_idx\n    ON a (id); -- trailing", "DROP INDEX CONCURRENTLY b_idx;"},
+		},
+		{
+			name: "Statement block",
+			src:  "-- +goose StatementBegin\nCREATE FUNCTION f() RETURNS INT AS $$\nBEGIN\n    RETURN 1;\nEND;\n$$ LANGUAGE plpgsql;\n-- +goose StatementEnd\nSELECT f();",
+			want: []string{"CREATE FUNCTION f() RETURNS INT AS $$\nBEGIN\n    RETURN 1;\nEND;\n$$ LANGUAGE plpgsql;", "SELECT f();"},
+		},
+		{
+			name: "Empty",
+			src:  "-- nothing to undo",
+		},
+		{
+			name:    "Missing semicolon",
+			src:     "CREATE INDEX CONCURRENTLY a_idx ON a (id)",
+			wantErr: true,
+		},
+		{
+			name:    "Unclosed block",
+			src:     "-- +goose StatementBegin\nSELECT 1;",
+			wantErr: true,
+		},
+		{
+			name:    "End without begin",
+			src:     "SELECT 1;\n-- +goose StatementEnd",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitStatements(strings.Split(tt.src, "\n"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitStatements() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("splitStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{
+			name: "Duplicate version",
+			fsys: fstest.MapFS{
+				"001_a.sql": {Data: []byte("-- +goose Up\nSELECT 1;")},
+				"1_b.sql":   {Data: []byte("-- +goose Up\nSELECT 1;")},
+			},
+		},
+		{
+			name: "No version",
+			fsys: fstest.MapFS{"users.sql": {Data: []byte("-- +goose Up\nSELECT 1;")}},
+		},
+		{
+			name: "No up section",
+			fsys: fstest.MapFS{"001_a.sql": {Data: []byte("CREATE TABLE a (id INT);")}},
+		},
+		{
+			name: "Unterminated statement without a transaction",
+			fsys: fstest.MapFS{"001_a.sql": {Data: []byte("-- +goose NO TRANSACTION\n-- +goose Up\nCREATE INDEX CONCURRENTLY a_idx ON a (id)\n")}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.fsys); err == nil {
+				t.Errorf("Load() err = nil, want error")
+			}
+		})
+	}
+}
+
+// the migrations we ship must load and be numbered without gaps
+func TestEmbeddedSchema(t *testing.T) {
+	migrations, err := Load(schema.FS)
+	if err != nil {
+		t.Fatalf("Load(schema.FS) err = %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("Load(schema.FS) found no migrations")
+	}
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %s has version %d, want %d", m.Name, m.Version, i+1)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %s has no down section", m.Name)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// stubIdP is just enough of an OpenID provider to drive the code flow: it
+// hands out one code per authorize call and checks PKCE on redemption.
+type stubIdP struct {
+	t      *testing.T
+	srv    *httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+	// what discovery claims the issuer is, defaults to the server URL
+	issuer string
+
+	challenge string
+	nonce     string
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &stubIdP{t: t, key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := idp.issuer
+		if issuer == "" {
+			issuer = idp.srv.URL
+		}
+		json.NewEncoder(w).Encode(discovery{
+			Issuer:                issuer,
+			AuthorizationEndpoint: idp.srv.URL + "/authorize",
+			TokenEndpoint:         idp.srv.URL + "/token",
+			JWKSURI:               idp.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []jwk{{
+			Kty: "RSA",
+			Kid: "stub-1",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "the-code" || S256Challenge(r.FormValue("code_verifier")) != idp.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		if id, secret, _ := r.BasicAuth(); id != "chirpy" || secret != "s3cret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(Token{
+			AccessToken: "idp-access",
+			TokenType:   "Bearer",
+			IDToken:     idp.idToken(),
+			ExpiresIn:   300,
+		})
+	})
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+
+	idp.claims = jwt.MapClaims{
+		"iss":            idp.srv.URL,
+		"aud":            "chirpy",
+		"sub":            "user-42",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+	}
+	return idp
+}
+
+// authorize plays the part of the browser being sent to the IdP and back.
+func (idp *stubIdP) authorize(authURL string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != "chirpy" {
+		idp.t.Fatalf("authorize request = %s, want S256 challenge for client chirpy", authURL)
+	}
+	idp.challenge = q.Get("code_challenge")
+	idp.nonce = q.Get("nonce")
+}
+
+func (idp *stubIdP) idToken() string {
+	claims := jwt.MapClaims{"nonce": idp.nonce}
+	for k, v := range idp.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "stub-1"
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	return signed
+}
+
+func newTestClient(t *testing.T, idp *stubIdP) *Client {
+	c, err := NewClient(context.Background(), Config{
+		Issuer:       idp.srv.URL,
+		ClientID:     "chirpy",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost:8080/api/auth/oidc/callback",
+		Scopes:       []string{"email"},
+	}, idp.srv.Client())
+	if err != nil {
+		t.Fatalf("NewClient() err = %v", err)
+	}
+	return c
+}
+
+func TestCodeFlow(t *testing.T) {
+	idp := newStubIdP(t)
+	c := newTestClient(t, idp)
+
+	verifier, _ := NewVerifier()
+	idp.authorize(c.AuthCodeURL("state", "nonce-1", verifier))
+
+	tok, err := c.Exchange(context.Background(), "the-code", verifier)
+	if err != nil {
+		t.Fatalf("Exchange() err = %v", err)
+	}
+
+	claims, err := c.VerifyIDToken(context.Background(), tok.IDToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken() err = %v", err)
+	}
+	if claims.Subject != "user-42" || claims.Email != "alice@example.com" || !claims.EmailVerified {
+		t.Errorf("VerifyIDToken() = %+v, want sub user-42 with verified alice@example.com", claims)
+	}
+}
+
+func TestExchangeWrongVerifier(t *testing.T) {
+	idp := newStubIdP(t)
+	c := newTestClient(t, idp)
+
+	verifier, _ := NewVerifier()
+	idp.authorize(c.AuthCodeURL("state", "nonce-1", verifier))
+
+	other, _ := NewVerifier()
+	if _, err := c.Exchange(context.Background(), "the-code", other); err == nil {
+		t.Errorf("Exchange() with wrong code_verifier err = nil, want error")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		nonce   string
+		wantErr error
+	}{
+		{
+			name:  "Valid",
+			nonce: "nonce-1",
+		},
+		{
+			name:    "Wrong nonce",
+			nonce:   "nonce-2",
+			wantErr: ErrNonceMismatch,
+		},
+		{
+			name:    "Wrong audience",
+			claims:  jwt.MapClaims{"aud": "someone-else"},
+			nonce:   "nonce-1",
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "Wrong issuer",
+			claims:  jwt.MapClaims{"iss": "https://evil.example.com"},
+			nonce:   "nonce-1",
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "Expired",
+			claims:  jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()},
+			nonce:   "nonce-1",
+			wantErr: ErrInvalidIDToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newStubIdP(t)
+			c := newTestClient(t, idp)
+			idp.nonce = "nonce-1"
+			for k, v := range tt.claims {
+				idp.claims[k] = v
+			}
+
+			_, err := c.VerifyIDToken(context.Background(), idp.idToken(), tt.nonce)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("VerifyIDToken() err = %v, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyIDToken() err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenForgedKey(t *testing.T) {
+	idp := newStubIdP(t)
+	c := newTestClient(t, idp)
+	idp.nonce = "nonce-1"
+
+	// same kid, different key: must not verify against the IdP's JWKS
+	forged, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.key = forged
+
+	if _, err := c.VerifyIDToken(context.Background(), idp.idToken(), "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("VerifyIDToken() with forged signature err = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp := newStubIdP(t)
+	idp.issuer = "https://evil.example.com"
+
+	_, err := NewClient(context.Background(), Config{Issuer: idp.srv.URL, ClientID: "chirpy"}, idp.srv.Client())
+	if err == nil {
+		t.Errorf("NewClient() with mismatched issuer err = nil, want error")
+	}
+}
@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+/*
+	Token bucket: each key has a bucket holding up to Burst tokens that refills
+	at Rate tokens per second. A request takes one token; an empty bucket means
+	the request is rejected until enough time passes for a token to drip back in.
+
+	Buckets are kept behind the Store interface so the in-process MemoryStore
+	can be swapped for a shared one (Redis, Postgres) once we run more than one
+	instance, without touching the middleware.
+*/
+
+var ErrInvalidLimit = errors.New("invalid rate limit")
+
+type Limit struct {
+	Rate  float64 // tokens per second
+	Burst int
+}
+
+// PerMinute allows n requests per minute with a burst of n. It panics if n
+// isn't positive; limits are fixed when routes are set up.
+func PerMinute(n int) Limit {
+	return mustLimit(Limit{Rate: float64(n) / 60, Burst: n})
+}
+
+// PerHour allows n requests per hour with a burst of n. It panics if n isn't
+// positive.
+func PerHour(n int) Limit {
+	return mustLimit(Limit{Rate: float64(n) / 3600, Burst: n})
+}
+
+// Validate reports whether the bucket can ever refill: a zero Rate would
+// divide by zero and a zero Burst would reject everything.
+func (l Limit) Validate() error {
+	if !(l.Rate > 0) || math.IsInf(l.Rate, 0) || l.Burst <= 0 {
+		return fmt.Errorf("%w: rate %v, burst %d", ErrInvalidLimit, l.Rate, l.Burst)
+	}
+	return nil
+}
+
+func mustLimit(l Limit) Limit {
+	if err := l.Validate(); err != nil {
+		panic(err)
+	}
+	return l
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// time until the bucket is full again
+	ResetAfter time.Duration
+	// time until the next request would be allowed, zero if Allowed
+	RetryAfter time.Duration
+}
+
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type MemoryStore struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	if err := limit.Validate(); err != nil {
+		return Result{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.updated).Seconds()
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+	b.updated = now
+
+	res := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = secondsToDuration((1 - b.tokens) / limit.Rate)
+	}
+
+	res.Remaining = int(b.tokens)
+	res.ResetAfter = secondsToDuration((float64(limit.Burst) - b.tokens) / limit.Rate)
+	return res, nil
+}
+
+// Prune removes buckets untouched for longer than idle. A bucket idle that
+// long has usually refilled completely, so dropping it changes nothing.
+func (s *MemoryStore) Prune(idle time.Duration) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	pruned := 0
+	for k, b := range s.buckets {
+		if now.Sub(b.updated) > idle {
+			delete(s.buckets, k)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
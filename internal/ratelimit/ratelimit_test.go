@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	limit := Limit{Rate: 1, Burst: 3}
+	ctx := context.Background()
+
+	for i := range 3 {
+		res, _ := s.Take(ctx, "ip:1", limit)
+		if !res.Allowed {
+			t.Fatalf("Take() #%d Allowed = false, want true", i+1)
+		}
+		if res.Remaining != 2-i {
+			t.Errorf("Take() #%d Remaining = %d, want %d", i+1, res.Remaining, 2-i)
+		}
+	}
+
+	res, _ := s.Take(ctx, "ip:1", limit)
+	if res.Allowed {
+		t.Fatalf("Take() on empty bucket Allowed = true, want false")
+	}
+	if res.RetryAfter != time.Second {
+		t.Errorf("Take() RetryAfter = %v, want 1s", res.RetryAfter)
+	}
+	if res.ResetAfter != 3*time.Second {
+		t.Errorf("Take() ResetAfter = %v, want 3s", res.ResetAfter)
+	}
+
+	// other keys have their own bucket
+	if res, _ := s.Take(ctx, "ip:2", limit); !res.Allowed {
+		t.Errorf("Take() other key Allowed = false, want true")
+	}
+
+	now = now.Add(time.Second)
+	if res, _ := s.Take(ctx, "ip:1", limit); !res.Allowed {
+		t.Errorf("Take() after refill Allowed = false, want true")
+	}
+
+	now = now.Add(time.Hour)
+	if n := s.Prune(time.Minute); n != 2 {
+		t.Errorf("Prune() = %d, want 2", n)
+	}
+}
+
+func TestPerMinute(t *testing.T) {
+	l := PerMinute(30)
+	if l.Burst != 30 || l.Rate != 0.5 {
+		t.Errorf("PerMinute(30) = %+v, want Rate 0.5 Burst 30", l)
+	}
+}
+
+func TestLimitValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   Limit
+		wantErr bool
+	}{
+		{name: "valid", limit: Limit{Rate: 1, Burst: 3}},
+		{name: "slow", limit: PerHour(1)},
+		{name: "zero rate", limit: Limit{Rate: 0, Burst: 3}, wantErr: true},
+		{name: "negative rate", limit: Limit{Rate: -1, Burst: 3}, wantErr: true},
+		{name: "NaN rate", limit: Limit{Rate: math.NaN(), Burst: 3}, wantErr: true},
+		{name: "infinite rate", limit: Limit{Rate: math.Inf(1), Burst: 3}, wantErr: true},
+		{name: "zero burst", limit: Limit{Rate: 1, Burst: 0}, wantErr: true},
+		{name: "zero value", limit: Limit{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limit.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidLimit) {
+				t.Errorf("Validate() err = %v, want ErrInvalidLimit", err)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreTakeInvalidLimit(t *testing.T) {
+	s := NewMemoryStore()
+	_, err := s.Take(context.Background(), "k", Limit{Rate: 0, Burst: 3})
+	if !errors.Is(err, ErrInvalidLimit) {
+		t.Errorf("Take() err = %v, want ErrInvalidLimit", err)
+	}
+}
+
+func TestPerHourPanicsOnNonPositive(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("PerHour(%d) didn't panic", n)
+				}
+			}()
+			PerHour(n)
+		}()
+	}
+}
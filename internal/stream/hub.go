@@ -0,0 +1,161 @@
+package stream
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+)
+
+/*
+	Hub fans events out to subscribers, e.g. one per open SSE connection.
+
+	Publish never waits for a subscriber: each one has a buffered channel, and
+	a subscriber whose buffer is full is dropped rather than allowed to hold up
+	everyone else (and the handler that published). A dropped client reconnects
+	with the ID of the last event it saw and gets what it missed from the
+	backlog, the last BacklogSize events.
+*/
+
+// Event is one message on the hub. Topics are what subscribers filter on,
+// e.g. "author:<id>".
+type Event struct {
+	ID     uint64
+	Type   string
+	Data   json.RawMessage
+	Topics []string
+}
+
+// HasTopic reports whether e was published under topic.
+func (e Event) HasTopic(topic string) bool {
+	return slices.Contains(e.Topics, topic)
+}
+
+type Hub struct {
+	// BufferSize is how many events a subscriber may fall behind by before
+	// it's dropped.
+	BufferSize int
+
+	mu      sync.Mutex
+	lastID  uint64
+	backlog []Event // oldest first, at most cap(backlog)
+	subs    map[*Subscription]struct{}
+}
+
+// NewHub keeps the last backlogSize events for resuming subscribers.
+func NewHub(backlogSize int) *Hub {
+	return &Hub{
+		BufferSize: 64,
+		// IDs carry on from the clock rather than from zero, so an ID from
+		// before a restart is never mistaken for a newer event
+		lastID:  uint64(time.Now().UnixMicro()),
+		backlog: make([]Event, 0, backlogSize),
+		subs:    map[*Subscription]struct{}{},
+	}
+}
+
+type Subscription struct {
+	// C delivers events. It's closed when the subscription ends, whether by
+	// Close or because the subscriber fell too far behind; check Dropped to
+	// tell which.
+	C <-chan Event
+
+	c       chan Event
+	match   func(Event) bool
+	hub     *Hub
+	dropped bool
+}
+
+// Dropped reports whether the hub ended the subscription because the
+// subscriber couldn't keep up. Only meaningful once C is closed.
+func (s *Subscription) Dropped() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.dropped
+}
+
+// Close ends the subscription. It's safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Publish assigns the event an ID, keeps it in the backlog and hands it to
+// every matching subscriber. It never blocks on subscribers.
+func (h *Hub) Publish(typ string, data json.RawMessage, topics ...string) Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	e := Event{ID: h.lastID, Type: typ, Data: data, Topics: topics}
+
+	if cap(h.backlog) > 0 {
+		if len(h.backlog) == cap(h.backlog) {
+			copy(h.backlog, h.backlog[1:])
+			h.backlog = h.backlog[:len(h.backlog)-1]
+		}
+		h.backlog = append(h.backlog, e)
+	}
+
+	for s := range h.subs {
+		if s.match != nil && !s.match(e) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			s.dropped = true
+			h.remove(s)
+		}
+	}
+	return e
+}
+
+// Subscribe starts delivering events that match (nil matches everything).
+// With a non-zero lastID it first returns the matching backlog events after
+// it; complete is false when the backlog no longer reaches back that far,
+// meaning some events are gone and the subscriber should resync some other
+// way.
+func (h *Hub) Subscribe(lastID uint64, match func(Event) bool) (sub *Subscription, missed []Event, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c := make(chan Event, h.BufferSize)
+	sub = &Subscription{C: c, c: c, match: match, hub: h}
+	h.subs[sub] = struct{}{}
+
+	complete = true
+	if lastID == 0 {
+		return sub, nil, complete
+	}
+	if lastID > h.lastID {
+		// not one of ours
+		return sub, nil, false
+	}
+	if len(h.backlog) == 0 || h.backlog[0].ID > lastID+1 {
+		complete = lastID == h.lastID
+	}
+	for _, e := range h.backlog {
+		if e.ID > lastID && (match == nil || match(e)) {
+			missed = append(missed, e)
+		}
+	}
+	return sub, missed, complete
+}
+
+// Subscribers is the number of open subscriptions.
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// remove drops s and closes its channel. Caller holds h.mu.
+func (h *Hub) remove(s *Subscription) {
+	if _, ok := h.subs[s]; !ok {
+		return
+	}
+	delete(h.subs, s)
+	close(s.c)
+}
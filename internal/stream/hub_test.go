@@ -0,0 +1,116 @@
+package stream
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestHubPublish(t *testing.T) {
+	h := NewHub(10)
+	all, _, _ := h.Subscribe(0, nil)
+	alice, _, _ := h.Subscribe(0, func(e Event) bool { return e.HasTopic("author:alice") })
+
+	first := h.Publish("created", json.RawMessage(`{"n":1}`), "author:alice")
+	second := h.Publish("created", json.RawMessage(`{"n":2}`), "author:bob")
+	if second.ID != first.ID+1 {
+		t.Errorf("IDs %d, %d are not consecutive", first.ID, second.ID)
+	}
+
+	if got := (<-all.C).ID; got != first.ID {
+		t.Errorf("all got %d, want %d", got, first.ID)
+	}
+	if got := (<-all.C).ID; got != second.ID {
+		t.Errorf("all got %d, want %d", got, second.ID)
+	}
+	if got := (<-alice.C).ID; got != first.ID {
+		t.Errorf("alice got %d, want %d", got, first.ID)
+	}
+	select {
+	case e := <-alice.C:
+		t.Errorf("alice got %+v, want nothing", e)
+	default:
+	}
+
+	all.Close()
+	all.Close()
+	if _, ok := <-all.C; ok {
+		t.Errorf("C still open after Close")
+	}
+	if all.Dropped() {
+		t.Errorf("Dropped() = true after Close")
+	}
+	if n := h.Subscribers(); n != 1 {
+		t.Errorf("Subscribers() = %d, want 1", n)
+	}
+}
+
+func TestHubSlowSubscriber(t *testing.T) {
+	h := NewHub(10)
+	h.BufferSize = 2
+	slow, _, _ := h.Subscribe(0, nil)
+
+	for range 3 {
+		h.Publish("created", nil)
+	}
+
+	n := 0
+	for range slow.C {
+		n++
+	}
+	if n != 2 || !slow.Dropped() {
+		t.Errorf("slow subscriber got %d events, Dropped() = %v; want 2, true", n, slow.Dropped())
+	}
+	if h.Subscribers() != 0 {
+		t.Errorf("Subscribers() = %d, want 0", h.Subscribers())
+	}
+}
+
+func TestHubResume(t *testing.T) {
+	h := NewHub(3)
+	var ids []uint64
+	for _, author := range []string{"a", "b", "a", "b", "a"} {
+		ids = append(ids, h.Publish("created", nil, "author:"+author).ID)
+	}
+	// backlog now holds ids[2:]
+
+	onlyA := func(e Event) bool { return e.HasTopic("author:a") }
+
+	tests := []struct {
+		name         string
+		lastID       uint64
+		match        func(Event) bool
+		wantMissed   []uint64
+		wantComplete bool
+	}{
+		{name: "Fresh", lastID: 0, wantComplete: true},
+		{name: "Up to date", lastID: ids[4], wantComplete: true},
+		{name: "Within backlog", lastID: ids[2], wantMissed: ids[3:], wantComplete: true},
+		{name: "Just before backlog", lastID: ids[1], wantMissed: ids[2:], wantComplete: true},
+		{name: "Filtered", lastID: ids[1], match: onlyA, wantMissed: []uint64{ids[2], ids[4]}, wantComplete: true},
+		{name: "Older than backlog", lastID: ids[0], wantMissed: ids[2:], wantComplete: false},
+		{name: "From the future", lastID: ids[4] + 100, wantComplete: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, missed, complete := h.Subscribe(tt.lastID, tt.match)
+			defer sub.Close()
+
+			var got []uint64
+			for _, e := range missed {
+				got = append(got, e.ID)
+			}
+			if len(got) != len(tt.wantMissed) {
+				t.Fatalf("missed = %v, want %v", got, tt.wantMissed)
+			}
+			for i := range got {
+				if got[i] != tt.wantMissed[i] {
+					t.Fatalf("missed = %v, want %v", got, tt.wantMissed)
+				}
+			}
+			if complete != tt.wantComplete {
+				t.Errorf("complete = %v, want %v", complete, tt.wantComplete)
+			}
+		})
+	}
+}
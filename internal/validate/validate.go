@@ -0,0 +1,159 @@
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+	Rules are declared on struct fields with the `validate` tag, e.g.
+
+		Email string `json:"email" validate:"required,email"`
+		Body  string `json:"body" validate:"required,max=140"`
+
+	Supported rules:
+		required  - field must not be the zero value
+		email     - string must be a bare RFC 5322 address ("a@b.c", no display name)
+		min=N     - string must be at least N characters (runes), numbers at least N
+		max=N     - string must be at most N characters (runes), numbers at most N
+
+	Field names in errors are taken from the `json` tag so they line up with
+	what the client actually sent.
+*/
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors aggregates every failing field instead of stopping at the first one.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Field+": "+fe.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Struct validates v (a struct or pointer to struct) against its `validate`
+// tags. It returns nil or an Errors value.
+func Struct(v any) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return fmt.Errorf("validate: nil %s", rv.Type())
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("validate: expected struct, got %s", rv.Kind())
+	}
+
+	var errs Errors
+	rt := rv.Type()
+	for i := range rt.NumField() {
+		sf := rt.Field(i)
+		tag := sf.Tag.Get("validate")
+		if tag == "" || !sf.IsExported() {
+			continue
+		}
+
+		name := fieldName(sf)
+		for _, rule := range strings.Split(tag, ",") {
+			msg, err := check(rv.Field(i), rule)
+			if err != nil {
+				return fmt.Errorf("validate: field %s: %w", sf.Name, err)
+			}
+			if msg != "" {
+				errs = append(errs, FieldError{Field: name, Message: msg})
+				// one message per field is enough for the client
+				break
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func fieldName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+// check returns a user facing message when the rule fails, or an error when
+// the rule itself is malformed (a programming mistake, not bad input).
+func check(fv reflect.Value, rule string) (string, error) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+	switch name {
+	case "":
+		return "", nil
+
+	case "required":
+		if fv.IsZero() {
+			return "is required", nil
+		}
+		return "", nil
+
+	case "email":
+		if fv.Kind() != reflect.String {
+			return "", fmt.Errorf("email rule on non-string field")
+		}
+		s := fv.String()
+		if s == "" {
+			return "", nil
+		}
+		addr, err := mail.ParseAddress(s)
+		if err != nil || addr.Address != s || !strings.Contains(s[strings.LastIndex(s, "@"):], ".") {
+			return "must be a valid email address", nil
+		}
+		return "", nil
+
+	case "min", "max":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return "", fmt.Errorf("bad %s argument %q", name, arg)
+		}
+		return checkBound(fv, name, n)
+	}
+
+	return "", fmt.Errorf("unknown rule %q", name)
+}
+
+func checkBound(fv reflect.Value, name string, n int) (string, error) {
+	var size int64
+	unit := ""
+
+	switch fv.Kind() {
+	case reflect.String:
+		size = int64(utf8.RuneCountInString(fv.String()))
+		unit = " characters"
+	case reflect.Slice, reflect.Map:
+		size = int64(fv.Len())
+		unit = " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = fv.Int()
+	default:
+		return "", fmt.Errorf("%s rule on unsupported kind %s", name, fv.Kind())
+	}
+
+	if name == "min" && size < int64(n) {
+		return fmt.Sprintf("must be at least %d%s", n, unit), nil
+	}
+	if name == "max" && size > int64(n) {
+		return fmt.Sprintf("must be at most %d%s", n, unit), nil
+	}
+	return "", nil
+}
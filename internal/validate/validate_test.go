@@ -0,0 +1,88 @@
+package validate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStruct(t *testing.T) {
+	type params struct {
+		Email string `json:"email" validate:"required,email"`
+		Body  string `json:"body" validate:"required,max=5"`
+		Name  string `json:"name" validate:"min=2"`
+	}
+
+	tests := []struct {
+		name       string
+		input      params
+		wantFields []string
+	}{
+		{
+			name:       "Valid",
+			input:      params{Email: "a@example.com", Body: "hi", Name: "ab"},
+			wantFields: nil,
+		},
+		{
+			name:       "Missing required fields",
+			input:      params{Name: "ab"},
+			wantFields: []string{"email", "body"},
+		},
+		{
+			name:       "Bad email and too long body",
+			input:      params{Email: "not-an-email", Body: "toolong", Name: "ab"},
+			wantFields: []string{"email", "body"},
+		},
+		{
+			name:       "Email with display name",
+			input:      params{Email: "Bob <bob@example.com>", Body: "hi", Name: "ab"},
+			wantFields: []string{"email"},
+		},
+		{
+			name:       "Max counts runes not bytes",
+			input:      params{Email: "a@example.com", Body: "héllo", Name: "ab"},
+			wantFields: nil,
+		},
+		{
+			name:       "Min on optional field",
+			input:      params{Email: "a@example.com", Body: "hi", Name: "a"},
+			wantFields: []string{"name"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Struct(&tt.input)
+			if len(tt.wantFields) == 0 {
+				if err != nil {
+					t.Fatalf("Struct() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var fieldErrs Errors
+			if !errors.As(err, &fieldErrs) {
+				t.Fatalf("Struct() error = %v, want Errors", err)
+			}
+			if len(fieldErrs) != len(tt.wantFields) {
+				t.Fatalf("Struct() got %d field errors (%v), want %d", len(fieldErrs), fieldErrs, len(tt.wantFields))
+			}
+			for i, f := range tt.wantFields {
+				if fieldErrs[i].Field != f {
+					t.Errorf("Struct() field[%d] = %s, want %s", i, fieldErrs[i].Field, f)
+				}
+			}
+		})
+	}
+}
+
+func TestStructBadRule(t *testing.T) {
+	var p struct {
+		Body string `validate:"bogus"`
+	}
+
+	err := Struct(&p)
+	var fieldErrs Errors
+	if err == nil || errors.As(err, &fieldErrs) {
+		t.Errorf("Struct() error = %v, want a rule error", err)
+	}
+}
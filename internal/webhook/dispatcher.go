@@ -0,0 +1,157 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharath070/Chirpy/internal/database"
+)
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Store is the part of database.Queries the dispatcher needs.
+type Store interface {
+	GetWebhook(ctx context.Context, id uuid.UUID) (database.Webhook, error)
+	GetWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, arg database.RecordWebhookAttemptParams) error
+	FailWebhookDelivery(ctx context.Context, arg database.FailWebhookDeliveryParams) error
+	RecordWebhookSuccess(ctx context.Context, id uuid.UUID) error
+	RecordWebhookFailure(ctx context.Context, id uuid.UUID) (int32, error)
+	DisableWebhook(ctx context.Context, arg database.DisableWebhookParams) error
+}
+
+// Dispatcher makes delivery attempts and keeps the delivery log. Retrying is
+// up to the caller, normally the job queue: Deliver returns an error when
+// the attempt should be retried.
+type Dispatcher struct {
+	// MaxAttempts is how often a delivery is tried; the last failed attempt
+	// marks it failed. Keep it in line with the retries the caller makes.
+	MaxAttempts int
+	// DisableAfter failed attempts in a row, across deliveries, turn a
+	// webhook off until its owner enables it again.
+	DisableAfter int
+	// OnDisable, if set, is called after a webhook was turned off for
+	// failing, e.g. to let its owner know.
+	OnDisable func(ctx context.Context, hook database.Webhook, reason string)
+
+	sender *Sender
+	store  Store
+}
+
+func NewDispatcher(store Store, sender *Sender) *Dispatcher {
+	return &Dispatcher{
+		MaxAttempts:  8,
+		DisableAfter: 20,
+		sender:       sender,
+		store:        store,
+	}
+}
+
+type envelope struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Deliver makes one attempt at delivery id and records how it went.
+func (d *Dispatcher) Deliver(ctx context.Context, id uuid.UUID) error {
+	del, err := d.store.GetWebhookDelivery(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the webhook was deleted, and its log with it
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if del.Status != StatusPending {
+		// already settled, e.g. a job run again after its lease ran out
+		return nil
+	}
+
+	hook, err := d.store.GetWebhook(ctx, del.WebhookID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if hook.DisabledAt.Valid {
+		return d.store.FailWebhookDelivery(ctx, database.FailWebhookDeliveryParams{
+			ID:        del.ID,
+			LastError: sql.NullString{String: "webhook is disabled", Valid: true},
+		})
+	}
+
+	body, err := json.Marshal(envelope{
+		ID:        del.ID,
+		Type:      del.EventType,
+		CreatedAt: del.CreatedAt,
+		Data:      del.Payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	res, sendErr := d.sender.Send(ctx, Request{
+		URL:        hook.Url,
+		Secret:     hook.Secret,
+		DeliveryID: del.ID,
+		Event:      del.EventType,
+		Body:       body,
+	})
+
+	attempt := database.RecordWebhookAttemptParams{
+		ID:             del.ID,
+		Status:         StatusSucceeded,
+		ResponseStatus: sql.NullInt32{Int32: int32(res.StatusCode), Valid: res.StatusCode != 0},
+		ResponseBody:   sql.NullString{String: res.Body, Valid: res.StatusCode != 0},
+	}
+	if sendErr == nil {
+		if err := d.store.RecordWebhookAttempt(ctx, attempt); err != nil {
+			return err
+		}
+		return d.store.RecordWebhookSuccess(ctx, hook.ID)
+	}
+
+	failures, err := d.store.RecordWebhookFailure(ctx, hook.ID)
+	if err != nil {
+		return err
+	}
+	disable := d.DisableAfter > 0 && int(failures) >= d.DisableAfter
+
+	attempt.Status = StatusPending
+	if disable || int(del.Attempts)+1 >= d.MaxAttempts {
+		attempt.Status = StatusFailed
+	}
+	attempt.LastError = sql.NullString{String: sendErr.Error(), Valid: true}
+	if err := d.store.RecordWebhookAttempt(ctx, attempt); err != nil {
+		return err
+	}
+
+	if disable {
+		reason := fmt.Sprintf("%d failed attempts in a row, the last: %v", failures, sendErr)
+		log.Printf("disabling webhook %s: %s", hook.ID, reason)
+		// retrying would only find it disabled
+		err := d.store.DisableWebhook(ctx, database.DisableWebhookParams{
+			ID:             hook.ID,
+			DisabledReason: sql.NullString{String: reason, Valid: true},
+		})
+		if err == nil && d.OnDisable != nil {
+			d.OnDisable(ctx, hook, reason)
+		}
+		return err
+	}
+	return sendErr
+}
@@ -0,0 +1,205 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharath070/Chirpy/internal/database"
+)
+
+// fakeStore holds one webhook and one delivery.
+type fakeStore struct {
+	hook database.Webhook
+	del  database.WebhookDelivery
+}
+
+func (s *fakeStore) GetWebhook(context.Context, uuid.UUID) (database.Webhook, error) {
+	return s.hook, nil
+}
+
+func (s *fakeStore) GetWebhookDelivery(context.Context, uuid.UUID) (database.WebhookDelivery, error) {
+	return s.del, nil
+}
+
+func (s *fakeStore) RecordWebhookAttempt(_ context.Context, arg database.RecordWebhookAttemptParams) error {
+	s.del.Status = arg.Status
+	s.del.Attempts++
+	s.del.ResponseStatus = arg.ResponseStatus
+	s.del.ResponseBody = arg.ResponseBody
+	s.del.LastError = arg.LastError
+	return nil
+}
+
+func (s *fakeStore) FailWebhookDelivery(_ context.Context, arg database.FailWebhookDeliveryParams) error {
+	s.del.Status = StatusFailed
+	s.del.LastError = arg.LastError
+	return nil
+}
+
+func (s *fakeStore) RecordWebhookSuccess(context.Context, uuid.UUID) error {
+	s.hook.ConsecutiveFailures = 0
+	return nil
+}
+
+func (s *fakeStore) RecordWebhookFailure(context.Context, uuid.UUID) (int32, error) {
+	s.hook.ConsecutiveFailures++
+	return s.hook.ConsecutiveFailures, nil
+}
+
+func (s *fakeStore) DisableWebhook(_ context.Context, arg database.DisableWebhookParams) error {
+	s.hook.DisabledAt = sql.NullTime{Time: time.Now(), Valid: true}
+	s.hook.DisabledReason = arg.DisabledReason
+	return nil
+}
+
+func TestDeliver(t *testing.T) {
+	const secret = "s3cret"
+
+	tests := []struct {
+		name         string
+		status       int
+		attempts     int32
+		failures     int32
+		disabled     bool
+		delStatus    string
+		wantErr      bool
+		wantHit      bool
+		wantStatus   string
+		wantFailures int32
+		wantDisabled bool
+	}{
+		{
+			name:         "Success resets the failure count",
+			status:       http.StatusNoContent,
+			failures:     3,
+			wantHit:      true,
+			wantStatus:   StatusSucceeded,
+			wantFailures: 0,
+		},
+		{
+			name:         "Failure is retried",
+			status:       http.StatusInternalServerError,
+			failures:     1,
+			wantErr:      true,
+			wantHit:      true,
+			wantStatus:   StatusPending,
+			wantFailures: 2,
+		},
+		{
+			name:         "Last attempt fails the delivery",
+			status:       http.StatusBadGateway,
+			attempts:     4,
+			wantErr:      true,
+			wantHit:      true,
+			wantStatus:   StatusFailed,
+			wantFailures: 1,
+		},
+		{
+			name:         "Too many failures disable the webhook",
+			status:       http.StatusNotFound,
+			failures:     2,
+			wantHit:      true,
+			wantStatus:   StatusFailed,
+			wantFailures: 3,
+			wantDisabled: true,
+		},
+		{
+			name:         "Disabled webhook isn't called",
+			disabled:     true,
+			wantStatus:   StatusFailed,
+			wantDisabled: true,
+		},
+		{
+			name:       "Settled delivery isn't sent again",
+			delStatus:  StatusSucceeded,
+			wantStatus: StatusSucceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hit := false
+			var got envelope
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hit = true
+				body, _ := io.ReadAll(r.Body)
+				if err := Verify(secret, r.Header.Get(SignatureHeader), body, time.Now(), time.Minute); err != nil {
+					t.Errorf("receiver: %v", err)
+				}
+				json.Unmarshal(body, &got)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			store := &fakeStore{
+				hook: database.Webhook{
+					ID:                  uuid.New(),
+					Url:                 srv.URL,
+					Secret:              secret,
+					ConsecutiveFailures: tt.failures,
+					DisabledAt:          sql.NullTime{Valid: tt.disabled},
+				},
+				del: database.WebhookDelivery{
+					ID:        uuid.New(),
+					CreatedAt: time.Now(),
+					EventType: "chirp.created",
+					Payload:   json.RawMessage(`{"body":"hi"}`),
+					Status:    StatusPending,
+					Attempts:  tt.attempts,
+				},
+			}
+			store.del.WebhookID = store.hook.ID
+			if tt.delStatus != "" {
+				store.del.Status = tt.delStatus
+			}
+
+			d := NewDispatcher(store, NewSender(5*time.Second, true))
+			d.MaxAttempts = 5
+			d.DisableAfter = 3
+			var disabledHook uuid.UUID
+			d.OnDisable = func(_ context.Context, hook database.Webhook, reason string) {
+				disabledHook = hook.ID
+				if reason == "" {
+					t.Errorf("OnDisable() without a reason")
+				}
+			}
+
+			err := d.Deliver(context.Background(), store.del.ID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Deliver() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if hit != tt.wantHit {
+				t.Errorf("receiver called = %v, want %v", hit, tt.wantHit)
+			}
+			if store.del.Status != tt.wantStatus {
+				t.Errorf("delivery status = %q, want %q", store.del.Status, tt.wantStatus)
+			}
+			if store.hook.ConsecutiveFailures != tt.wantFailures {
+				t.Errorf("consecutive failures = %d, want %d", store.hook.ConsecutiveFailures, tt.wantFailures)
+			}
+			if store.hook.DisabledAt.Valid != tt.wantDisabled {
+				t.Errorf("disabled = %v, want %v", store.hook.DisabledAt.Valid, tt.wantDisabled)
+			}
+			// only for webhooks this attempt disabled
+			if wantNotified := tt.wantDisabled && !tt.disabled; (disabledHook == store.hook.ID) != wantNotified {
+				t.Errorf("OnDisable() called = %v, want %v", disabledHook == store.hook.ID, wantNotified)
+			}
+
+			if hit {
+				if got.ID != store.del.ID || got.Type != "chirp.created" || string(got.Data) != `{"body":"hi"}` {
+					t.Errorf("receiver got envelope %+v", got)
+				}
+				if int(store.del.ResponseStatus.Int32) != tt.status {
+					t.Errorf("logged response status = %d, want %d", store.del.ResponseStatus.Int32, tt.status)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+/*
+	Every delivery is a POST of a JSON envelope
+
+		{"id": "<delivery id>", "type": "chirp.created", "created_at": "...", "data": {...}}
+
+	signed with the webhook's secret:
+
+		Chirpy-Signature: t=1700000000,v1=<hex HMAC-SHA256 of "1700000000." + body>
+
+	The timestamp is part of what's signed, so receivers can turn away old
+	requests replayed at them (see Verify). Retries of a delivery carry the
+	same id; receivers should treat a repeated id as already handled.
+*/
+
+const (
+	SignatureHeader = "Chirpy-Signature"
+	EventHeader     = "Chirpy-Event"
+	DeliveryHeader  = "Chirpy-Delivery"
+)
+
+// maxResponseBody is how much of a receiver's answer goes in the delivery
+// log.
+const maxResponseBody = 1 << 10
+
+var (
+	ErrInvalidSignature = errors.New("webhook: invalid signature")
+	ErrPrivateAddress   = errors.New("webhook: refusing to connect to a private address")
+)
+
+// Sign returns the Chirpy-Signature header value for body sent at t.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + mac(secret, ts, body)
+}
+
+func mac(secret, ts string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(ts + "."))
+	m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// Verify checks a Chirpy-Signature header against body, as a receiver
+// would. Signatures older than tolerance are rejected.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var ts string
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sigs = append(sigs, v)
+		}
+	}
+
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if d := now.Sub(time.Unix(sec, 0)); d > tolerance || d < -tolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+	}
+
+	want := mac(secret, ts, body)
+	for _, sig := range sigs {
+		if hmac.Equal([]byte(sig), []byte(want)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// CheckURL validates a webhook URL when it's registered. Where it points is
+// checked again on every delivery, see Sender.
+func CheckURL(raw string) error {
+	if len(raw) > 2048 {
+		return errors.New("url is too long")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return errors.New("url is not valid")
+	}
+	switch {
+	case u.Scheme != "https" && u.Scheme != "http":
+		return errors.New("url must be http or https")
+	case u.Host == "":
+		return errors.New("url must have a host")
+	case u.User != nil:
+		return errors.New("url must not contain credentials")
+	case u.Fragment != "":
+		return errors.New("url must not contain a fragment")
+	}
+	return nil
+}
+
+// Request is one delivery attempt.
+type Request struct {
+	URL        string
+	Secret     string
+	DeliveryID uuid.UUID
+	Event      string
+	Body       []byte
+}
+
+// Result is what the receiver answered. StatusCode is 0 when it never got
+// to answer.
+type Result struct {
+	StatusCode int
+	Body       string
+	Duration   time.Duration
+}
+
+type Sender struct {
+	Client *http.Client
+	now    func() time.Time
+}
+
+// NewSender returns a Sender that gives receivers timeout to answer and
+// doesn't follow redirects. Unless allowPrivate is set it won't connect to
+// loopback, private, link-local, CGNAT or NAT64 addresses, so a webhook
+// can't be used to reach into our own network.
+func NewSender(timeout time.Duration, allowPrivate bool) *Sender {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		// a proxy would make the dial guard check the proxy's address
+		transport.Proxy = nil
+		dialer := &net.Dialer{Timeout: timeout, Control: guardDial}
+		transport.DialContext = dialer.DialContext
+	}
+
+	return &Sender{
+		Client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		now: time.Now,
+	}
+}
+
+// deniedPrefixes are ranges that aren't private by netip's definition but
+// still lead into someone's network.
+var deniedPrefixes = []netip.Prefix{
+	// carrier-grade NAT, where some clouds put their metadata service
+	// (100.100.100.200)
+	netip.MustParsePrefix("100.64.0.0/10"),
+	// NAT64, which maps every IPv4 address, private ones included
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// guardDial runs after DNS resolution, on the address actually dialled, so
+// a hostname can't resolve its way past it.
+func guardDial(network, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if deniedAddr(ap.Addr()) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+func deniedAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return true
+	}
+	for _, p := range deniedPrefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Send makes one attempt. Anything but a 2xx answer is an error.
+func (s *Sender) Send(ctx context.Context, req Request) (Result, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.URL, bytes.NewReader(req.Body))
+	if err != nil {
+		return Result{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	httpReq.Header.Set(EventHeader, req.Event)
+	httpReq.Header.Set(DeliveryHeader, req.DeliveryID.String())
+	httpReq.Header.Set(SignatureHeader, Sign(req.Secret, s.now(), req.Body))
+
+	start := time.Now()
+	resp, err := s.Client.Do(httpReq)
+	res := Result{Duration: time.Since(start)}
+	if err != nil {
+		return res, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	res.StatusCode = resp.StatusCode
+	// it goes in a TEXT column, which takes neither NULs nor broken UTF-8
+	res.Body = strings.ToValidUTF8(strings.ReplaceAll(string(body), "\x00", ""), "\uFFFD")
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return res, fmt.Errorf("webhook: receiver answered %s", resp.Status)
+	}
+	return res, nil
+}
@@ -0,0 +1,236 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// RFC 6455 section 1.3
+	if got := AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("AcceptKey() = %q", got)
+	}
+}
+
+// echoServer echoes every message back until the client closes.
+func echoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.MaxMessageSize = 1024
+		c.PongHandler = func(data []byte) {
+			// report unsolicited pongs back, so the test can see them
+			c.WriteMessage(TextMessage, append([]byte("pong:"), data...))
+		}
+		for {
+			op, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := c.WriteMessage(op, data); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+type testClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dial(t *testing.T, srv *httptest.Server) *testClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: x\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake response %d %v", resp.StatusCode, resp.Header)
+	}
+	return &testClient{conn: conn, br: br}
+}
+
+// send writes one masked frame, as browsers do.
+func (c *testClient) send(fin bool, op int, payload []byte) {
+	b0 := byte(op)
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, 0x80|byte(n))
+	default:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	c.conn.Write(frame)
+}
+
+func (c *testClient) recv(t *testing.T) (int, []byte) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	if head[1]&0x80 != 0 {
+		t.Fatalf("server frame is masked")
+	}
+	n := int(head[1] & 0x7f)
+	if n == 126 {
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, n)
+	io.ReadFull(c.br, payload)
+	return int(head[0] & 0x0f), payload
+}
+
+func TestEcho(t *testing.T) {
+	c := dial(t, echoServer(t))
+
+	c.send(true, TextMessage, []byte("hello"))
+	if op, data := c.recv(t); op != TextMessage || string(data) != "hello" {
+		t.Errorf("echo = %d %q, want text hello", op, data)
+	}
+
+	c.send(true, PongMessage, []byte("beat"))
+	if op, data := c.recv(t); op != TextMessage || string(data) != "pong:beat" {
+		t.Errorf("pong handler = %d %q, want text pong:beat", op, data)
+	}
+
+	// fragmented, with a ping in the middle
+	c.send(false, TextMessage, []byte("frag"))
+	c.send(true, PingMessage, []byte("p"))
+	c.send(true, continuationFrame, []byte(strings.Repeat("x", 200)))
+	if op, data := c.recv(t); op != PongMessage || string(data) != "p" {
+		t.Errorf("ping answer = %d %q, want pong p", op, data)
+	}
+	if op, data := c.recv(t); op != TextMessage || string(data) != "frag"+strings.Repeat("x", 200) {
+		t.Errorf("fragmented echo = %d %q", op, data)
+	}
+
+	c.send(true, CloseMessage, binary.BigEndian.AppendUint16(nil, CloseGoingAway))
+	op, data := c.recv(t)
+	if op != CloseMessage || binary.BigEndian.Uint16(data) != CloseGoingAway {
+		t.Errorf("close answer = %d %v, want close 1001", op, data)
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		send     func(c *testClient)
+		wantCode int
+	}{
+		{
+			name: "Unmasked frame",
+			send: func(c *testClient) {
+				c.conn.Write([]byte{0x81, 0x02, 'h', 'i'})
+			},
+			wantCode: CloseProtocolError,
+		},
+		{
+			name:     "Invalid UTF-8",
+			send:     func(c *testClient) { c.send(true, TextMessage, []byte{0xff, 0xfe}) },
+			wantCode: CloseInvalidPayload,
+		},
+		{
+			name:     "Too big",
+			send:     func(c *testClient) { c.send(true, BinaryMessage, make([]byte, 2000)) },
+			wantCode: CloseMessageTooBig,
+		},
+		{
+			name:     "Continuation without a message",
+			send:     func(c *testClient) { c.send(true, continuationFrame, []byte("x")) },
+			wantCode: CloseProtocolError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := dial(t, echoServer(t))
+			tt.send(c)
+			op, data := c.recv(t)
+			if op != CloseMessage || len(data) < 2 || int(binary.BigEndian.Uint16(data)) != tt.wantCode {
+				t.Errorf("got frame %d %v, want close %d", op, data, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestUpgradeRejects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := Upgrade(w, r); !errors.Is(err, ErrBadHandshake) {
+			t.Errorf("Upgrade() err = %v, want ErrBadHandshake", err)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{name: "Plain request", want: http.StatusUpgradeRequired},
+		{
+			name:    "Old version",
+			headers: map[string]string{"Connection": "keep-alive, Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "8"},
+			want:    http.StatusUpgradeRequired,
+		},
+		{
+			name:    "Bad key",
+			headers: map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "short"},
+			want:    http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -1,21 +1,71 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
 	"os"
 	"sync/atomic"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"github.com/sharath070/Chirpy/internal/auth"
 	"github.com/sharath070/Chirpy/internal/database"
+	"github.com/sharath070/Chirpy/internal/events"
+	"github.com/sharath070/Chirpy/internal/jobs"
+	"github.com/sharath070/Chirpy/internal/mailer"
+	"github.com/sharath070/Chirpy/internal/migrate"
+	"github.com/sharath070/Chirpy/internal/oidc"
+	"github.com/sharath070/Chirpy/internal/ratelimit"
+	"github.com/sharath070/Chirpy/internal/stream"
+	"github.com/sharath070/Chirpy/internal/webhook"
+	"github.com/sharath070/Chirpy/sql/schema"
 )
 
 type apiConfig struct {
-	fileSeverHits atomic.Int32
-	dbQueries     *database.Queries
-	jwtSecret     string
+	fileSeverHits  atomic.Int32
+	db             *sql.DB
+	dbQueries      *database.Queries
+	queryStats     *database.QueryStats
+	tx             *database.TxRunner
+	migrator       *migrate.Migrator
+	keyring        *auth.Keyring
+	passwordPolicy auth.PasswordPolicy
+	passwordHasher auth.PasswordHasher
+	loginLimiter   *auth.LoginLimiter
+	// logins the limiter turned away, counted rather than audited
+	throttledLogins atomic.Int64
+	// compared against when the email is unknown, see handleLoginUser
+	dummyPasswordHash string
+	rateLimitStore    ratelimit.Store
+	mailer            mailer.Mailer
+	// where links in emails point, e.g. https://chirpy.example.com
+	publicURL string
+	// nil when external sign-in isn't configured
+	oidc         *oidc.Client
+	oidcProvider string
+	// COOKIE_SESSIONS, see cookies.go
+	cookieSessions bool
+	// how long authors can undo a delete, and how long deleted chirps are
+	// kept before being purged
+	chirpRestoreWindow time.Duration
+	chirpRetention     time.Duration
+	scheduler          *jobs.Scheduler
+	jobQueue           *jobs.Queue
+	// ADMIN_USER_IDS, see requireAdmin
+	admins map[uuid.UUID]bool
+	// chirp events for GET /api/stream/chirps
+	chirpHub *stream.Hub
+	// new notifications for GET /api/stream/ws, under "user:<id>" topics
+	notificationHub *stream.Hub
+	// domain events, shared between instances with EVENT_BUS=postgres
+	events events.Bus
+	// sessions revoked before their access tokens expire
+	revocations *auth.RevocationList
+	webhooks    *webhook.Dispatcher
 }
 
 const (
@@ -25,38 +75,166 @@ const (
 
 func main() {
 	godotenv.Load()
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
+	db := openDBFromEnv()
+
+	migrator, err := migrate.New(db, schema.FS)
 	if err != nil {
-		log.Fatal("DB connection failed")
+		log.Fatal("Failed to load migrations: ", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrateCommand(migrator, os.Args[2:])
 		return
 	}
+	migrateOnStart(migrator)
+
+	passwordHasher := passwordHasherFromEnv()
+	dummyHash, err := passwordHasher.Hash("chirpy-dummy-password")
+	if err != nil {
+		log.Fatal("Failed to create dummy password hash: ", err)
+	}
+
+	publicURL := envString("PUBLIC_URL", "http://localhost:"+port)
+	oidcClient, oidcProvider := oidcFromEnv(publicURL)
+
+	// every query gets at most DB_QUERY_TIMEOUT, however long the request has
+	queryTimeout := envDuration("DB_QUERY_TIMEOUT", 5*time.Second)
+	queryStats := &database.QueryStats{}
+	dbQueries := database.New(&database.TimeoutDB{
+		DB:      db,
+		Timeout: queryTimeout,
+		Stats:   queryStats,
+	})
+
+	chirpRestoreWindow := envDuration("CHIRP_RESTORE_WINDOW", 7*24*time.Hour)
+	chirpRetention := envDuration("CHIRP_RETENTION", 30*24*time.Hour)
+	if chirpRetention < chirpRestoreWindow {
+		log.Fatal("CHIRP_RETENTION must not be shorter than CHIRP_RESTORE_WINDOW")
+	}
 
 	cfg := apiConfig{
-		fileSeverHits: atomic.Int32{},
-		dbQueries:     database.New(db),
-		jwtSecret:     os.Getenv("SECRET"),
+		fileSeverHits:      atomic.Int32{},
+		db:                 db,
+		dbQueries:          dbQueries,
+		queryStats:         queryStats,
+		tx:                 &database.TxRunner{DB: db, Timeout: queryTimeout, Stats: queryStats},
+		migrator:           migrator,
+		keyring:            keyringFromEnv(),
+		passwordPolicy:     auth.DefaultPasswordPolicy(),
+		passwordHasher:     passwordHasher,
+		loginLimiter:       auth.NewLoginLimiter(auth.DefaultLoginLimiterConfig),
+		dummyPasswordHash:  dummyHash,
+		rateLimitStore:     ratelimit.NewMemoryStore(),
+		mailer:             mailerFromEnv(),
+		publicURL:          publicURL,
+		oidc:               oidcClient,
+		oidcProvider:       oidcProvider,
+		cookieSessions:     os.Getenv("COOKIE_SESSIONS") == "true",
+		chirpRestoreWindow: chirpRestoreWindow,
+		chirpRetention:     chirpRetention,
+		scheduler:          jobs.NewScheduler(),
+		jobQueue:           jobs.NewQueue(dbQueries),
+		admins:             adminsFromEnv(),
+		chirpHub:           stream.NewHub(envInt("STREAM_BACKLOG", 1000)),
+		// notifications are in the database, clients catch up from there
+		notificationHub: stream.NewHub(0),
+		events:          eventBusFromEnv(db),
+		revocations:     auth.NewRevocationList(accessTokenTTL),
 	}
 
 	mux := http.NewServeMux()
-	mux.Handle("GET /app/", cfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(fileRootPath)))))
+	staticFiles := cfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(fileRootPath))))
+	mux.Handle("GET /app/", staticFiles)
+	// the consent page's Allow button mustn't be clickable from inside a
+	// client's page (RFC 6749 10.13)
+	mux.Handle("GET /app/oauth/", middlewareDenyFraming(staticFiles))
 	mux.HandleFunc("GET /healthz", healthHandler)
+	mux.HandleFunc("GET /readyz", cfg.handleReady)
 	mux.HandleFunc("GET /metrics", cfg.handleMetrics)
 	mux.HandleFunc("POST /reset", cfg.handleReset)
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.handleJWKS)
 
 	// USERS
-	mux.HandleFunc("POST /api/users", cfg.handleCreateUser)
-	mux.HandleFunc("POST /api/login", cfg.handleLoginUser)
+	mux.Handle("POST /api/users", cfg.middlewareRateLimit("users:create", ratelimit.PerHour(10), http.HandlerFunc(cfg.handleCreateUser)))
+	mux.Handle("PUT /api/users", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleUpdateUser)))
+	mux.Handle("POST /api/login", cfg.middlewareRateLimit("login", ratelimit.PerMinute(20), http.HandlerFunc(cfg.handleLoginUser)))
+	mux.Handle("POST /api/login/2fa", cfg.middlewareRateLimit("login", ratelimit.PerMinute(20), http.HandlerFunc(cfg.handleLoginTwoFactor)))
 	mux.HandleFunc("POST /api/refresh", cfg.handleRefresh)
+	mux.Handle("POST /api/logout", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleLogout)))
+	mux.HandleFunc("POST /api/users/verify", cfg.handleVerifyEmail)
+	mux.Handle("POST /api/users/verify/resend", cfg.requireAuthScope(auth.ScopeAccount, cfg.middlewareRateLimit("verify:resend", ratelimit.PerHour(5), http.HandlerFunc(cfg.handleResendVerification))))
+	mux.Handle("POST /api/password/forgot", cfg.middlewareRateLimit("password:forgot", ratelimit.PerHour(5), http.HandlerFunc(cfg.handleForgotPassword)))
+	mux.Handle("POST /api/password/reset", cfg.middlewareRateLimit("password:reset", ratelimit.PerHour(10), http.HandlerFunc(cfg.handleResetPassword)))
+
+	// EXTERNAL SIGN-IN
+	if cfg.oidc != nil {
+		mux.Handle("GET /api/auth/oidc/login", cfg.middlewareRateLimit("login", ratelimit.PerMinute(20), http.HandlerFunc(cfg.handleOIDCLogin)))
+		mux.HandleFunc("GET /api/auth/oidc/callback", cfg.handleOIDCCallback)
+	}
+
+	// TWO-FACTOR
+	mux.Handle("POST /api/users/me/2fa", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleEnrollTwoFactor)))
+	mux.Handle("POST /api/users/me/2fa/verify", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleConfirmTwoFactor)))
+	mux.Handle("DELETE /api/users/me/2fa", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleDisableTwoFactor)))
+
+	// SESSIONS
+	mux.Handle("GET /api/sessions", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleListSessions)))
+	mux.Handle("DELETE /api/sessions", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleRevokeOtherSessions)))
+	mux.Handle("DELETE /api/sessions/{sessionID}", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleRevokeSession)))
+
+	// PERSONAL ACCESS TOKENS
+	mux.Handle("POST /api/tokens", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleCreateToken)))
+	mux.Handle("GET /api/tokens", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleListTokens)))
+	mux.Handle("DELETE /api/tokens/{tokenID}", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleRevokeToken)))
+
+	// OAUTH (Chirpy as authorization server for third party apps)
+	mux.Handle("POST /api/oauth/clients", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleCreateOAuthClient)))
+	mux.Handle("GET /api/oauth/clients", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleListOAuthClients)))
+	mux.Handle("DELETE /api/oauth/clients/{clientID}", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleDeleteOAuthClient)))
+	mux.Handle("GET /api/oauth/grants", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleListOAuthGrants)))
+	mux.Handle("DELETE /api/oauth/grants/{grantID}", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleRevokeOAuthGrant)))
+	mux.HandleFunc("GET /oauth/authorize", cfg.handleOAuthAuthorize)
+	mux.Handle("GET /api/oauth/authorize", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleDescribeAuthorize)))
+	mux.Handle("POST /api/oauth/authorize", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleApproveAuthorize)))
+	mux.Handle("POST /api/oauth/token", cfg.middlewareRateLimit("oauth:token", ratelimit.PerMinute(60), http.HandlerFunc(cfg.handleOAuthToken)))
+	mux.HandleFunc("POST /api/oauth/introspect", cfg.handleOAuthIntrospect)
+	mux.HandleFunc("POST /api/oauth/revoke", cfg.handleOAuthRevoke)
 
 	//  CHIRPS
-	mux.HandleFunc("POST /api/chirps", cfg.handleCreateChirp)
-	mux.HandleFunc("GET /api/chirps", cfg.handleGetAllChirps)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.handleGetChirp)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.handleDeleteChirp)
+	mux.Handle("POST /api/chirps", cfg.requireAuthScope(auth.ScopeChirpsWrite, cfg.middlewareRateLimit("chirps:create", ratelimit.PerMinute(30), http.HandlerFunc(cfg.handleCreateChirp))))
+	mux.Handle("GET /api/chirps", cfg.optionalAuth(cfg.requireScope(auth.ScopeChirpsRead, http.HandlerFunc(cfg.handleGetAllChirps))))
+	mux.Handle("GET /api/chirps/{chirpID}", cfg.optionalAuth(cfg.requireScope(auth.ScopeChirpsRead, http.HandlerFunc(cfg.handleGetChirp))))
+	mux.Handle("DELETE /api/chirps/{chirpID}", cfg.requireAuthScope(auth.ScopeChirpsWrite, http.HandlerFunc(cfg.handleDeleteChirp)))
+	mux.Handle("POST /api/chirps/{chirpID}/restore", cfg.requireAuthScope(auth.ScopeChirpsWrite, http.HandlerFunc(cfg.handleRestoreChirp)))
+
+	// NOTIFICATIONS
+	mux.Handle("GET /api/notifications", cfg.requireAuthScope(auth.ScopeNotifications, http.HandlerFunc(cfg.handleListNotifications)))
+	mux.Handle("POST /api/notifications/read", cfg.requireAuthScope(auth.ScopeNotifications, http.HandlerFunc(cfg.handleMarkNotificationsRead)))
+
+	// STREAMING
+	mux.Handle("GET /api/stream/chirps", cfg.optionalAuth(cfg.requireScope(auth.ScopeChirpsRead, http.HandlerFunc(cfg.handleChirpStream))))
+	mux.Handle("GET /api/stream/ws", cfg.requireAuth(http.HandlerFunc(cfg.handleWebSocket)))
+
+	// WEBHOOKS
+	mux.Handle("POST /api/webhooks", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleCreateWebhook)))
+	mux.Handle("GET /api/webhooks", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleListWebhooks)))
+	mux.Handle("GET /api/webhooks/{webhookID}", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleGetWebhook)))
+	mux.Handle("DELETE /api/webhooks/{webhookID}", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleDeleteWebhook)))
+	mux.Handle("POST /api/webhooks/{webhookID}/enable", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleEnableWebhook)))
+	mux.Handle("GET /api/webhooks/{webhookID}/deliveries", cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(cfg.handleListWebhookDeliveries)))
+
+	// ADMIN
+	mux.Handle("GET /api/admin/jobs", cfg.requireAdmin(http.HandlerFunc(cfg.handleJobStatus)))
+
+	cfg.subscribeEvents()
+	cfg.registerWebhookJobs()
+	cfg.registerMaintenanceJobs(cfg.scheduler)
+	go cfg.scheduler.Run(context.Background())
+	for range envInt("JOB_WORKERS", 2) {
+		go cfg.jobQueue.Work(context.Background())
+	}
 
 	srv := http.Server{
-		Handler: mux,
+		Handler: middlewareTimeout(envDuration("REQUEST_TIMEOUT", 15*time.Second), mux),
 		Addr:    ":" + port,
 	}
 
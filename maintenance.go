@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/sharath070/Chirpy/internal/jobs"
+	"github.com/sharath070/Chirpy/internal/ratelimit"
+)
+
+const (
+	// rate limit buckets idle this long have refilled, even PerHour ones
+	rateLimitIdle = time.Hour
+	// how long finished queue jobs stay visible on the admin endpoint
+	finishedJobRetention = 7 * 24 * time.Hour
+	// read notifications are deleted this long after being read
+	readNotificationRetention = 90 * 24 * time.Hour
+	// how far back the webhook delivery log goes
+	webhookDeliveriesRetention = 30 * 24 * time.Hour
+)
+
+// registerMaintenanceJobs adds the housekeeping that keeps tables and
+// in-memory state from growing forever.
+func (cfg *apiConfig) registerMaintenanceJobs(s *jobs.Scheduler) {
+	s.Every("purge-refresh-tokens", time.Hour, cfg.purgeRefreshTokens)
+	s.Every("purge-deleted-chirps", envDuration("CHIRP_PURGE_INTERVAL", time.Hour), cfg.purgeDeletedChirps)
+	s.Every("prune-rate-limits", 10*time.Minute, cfg.pruneRateLimits)
+	s.Every("prune-revocations", 10*time.Minute, cfg.pruneRevocations)
+	s.Every("requeue-stale-jobs", time.Minute, cfg.jobQueue.RequeueStale)
+	s.Every("purge-finished-jobs", 24*time.Hour, cfg.purgeFinishedJobs)
+	s.Every("purge-read-notifications", 24*time.Hour, cfg.purgeReadNotifications)
+	s.Every("purge-webhook-deliveries", 24*time.Hour, cfg.purgeWebhookDeliveries)
+}
+
+// purgeRefreshTokens deletes sessions that can't be used anymore. Revoked
+// ones are kept while their access tokens could still be around, for
+// loadRevocations to find.
+func (cfg *apiConfig) purgeRefreshTokens(ctx context.Context) error {
+	cutoff := sql.NullTime{Time: time.Now().Add(-accessTokenTTL), Valid: true}
+	n, err := cfg.dbQueries.PurgeRefreshTokens(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("purged %d expired or revoked refresh tokens", n)
+	}
+	return nil
+}
+
+// purgeDeletedChirps hard-deletes chirps soft-deleted more than
+// chirpRetention ago.
+func (cfg *apiConfig) purgeDeletedChirps(ctx context.Context) error {
+	cutoff := sql.NullTime{Time: time.Now().Add(-cfg.chirpRetention), Valid: true}
+	n, err := cfg.dbQueries.PurgeDeletedChirps(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("purged %d deleted chirps", n)
+	}
+	return nil
+}
+
+// pruneRateLimits drops idle rate limit buckets and login failure entries.
+// Shared stores expire their own keys.
+func (cfg *apiConfig) pruneRateLimits(ctx context.Context) error {
+	if mem, ok := cfg.rateLimitStore.(*ratelimit.MemoryStore); ok {
+		mem.Prune(rateLimitIdle)
+	}
+	cfg.loginLimiter.Prune()
+	return nil
+}
+
+// pruneRevocations forgets revoked sessions whose access tokens have all
+// expired by now.
+func (cfg *apiConfig) pruneRevocations(ctx context.Context) error {
+	cfg.revocations.Prune()
+	return nil
+}
+
+func (cfg *apiConfig) purgeFinishedJobs(ctx context.Context) error {
+	cutoff := sql.NullTime{Time: time.Now().Add(-finishedJobRetention), Valid: true}
+	_, err := cfg.dbQueries.DeleteFinishedJobs(ctx, cutoff)
+	return err
+}
+
+func (cfg *apiConfig) purgeReadNotifications(ctx context.Context) error {
+	cutoff := sql.NullTime{Time: time.Now().Add(-readNotificationRetention), Valid: true}
+	n, err := cfg.dbQueries.DeleteReadNotifications(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("purged %d read notifications", n)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) purgeWebhookDeliveries(ctx context.Context) error {
+	_, err := cfg.dbQueries.DeleteOldWebhookDeliveries(ctx, time.Now().Add(-webhookDeliveriesRetention))
+	return err
+}
@@ -1,6 +1,19 @@
 package main
 
-import "net/http"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sharath070/Chirpy/internal/auth"
+	"github.com/sharath070/Chirpy/internal/ratelimit"
+)
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -8,3 +21,169 @@ func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// middlewareTimeout gives every request a deadline. Queries inherit it
+// through r.Context(), so a slow request stops using the database once the
+// client could no longer get an answer anyway. Streams under
+// streamPathPrefix are meant to stay open and are left alone; their queries
+// still get DB_QUERY_TIMEOUT each.
+func middlewareTimeout(timeout time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, streamPathPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// middlewareDenyFraming stops other sites from showing the response in a
+// frame, for pages where a click does something on the user's behalf.
+func middlewareDenyFraming(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// middlewareRateLimit applies limit to next, with a separate bucket per
+// route name and caller. Authenticated callers are limited per user, everyone
+// else per client IP, so put it inside middlewareAuth on protected routes.
+// A limit that can't work panics here, at startup, rather than failing open
+// on every request.
+func (cfg *apiConfig) middlewareRateLimit(route string, limit ratelimit.Limit, next http.Handler) http.Handler {
+	if err := limit.Validate(); err != nil {
+		panic(fmt.Sprintf("rate limit for %s: %v", route, err))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := route + ":ip:" + clientIP(r)
+		if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+			key = route + ":user:" + p.UserID.String()
+		}
+
+		res, err := cfg.rateLimitStore.Take(r.Context(), key, limit)
+		if err != nil {
+			// fail open, a broken limiter shouldn't take the API down with it
+			log.Println("rate limit store:", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(res.ResetAfter.Seconds()))))
+
+		if !res.Allowed {
+			setRetryAfter(w, res.RetryAfter)
+			respondWithErr(w, http.StatusTooManyRequests, "Rate limit exceeded", nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+var errNoCredentials = errors.New("no credentials")
+
+// requestToken finds the access token: the Authorization header if there is
+// one, otherwise the session cookie when cookie mode is on.
+func (cfg *apiConfig) requestToken(r *http.Request) (token string, fromCookie bool, err error) {
+	if r.Header.Get("Authorization") != "" {
+		token, err = auth.GetBearerToken(r.Header)
+		return token, false, err
+	}
+	if cfg.cookieSessions {
+		if c, err := r.Cookie(accessCookieName); err == nil && c.Value != "" {
+			return c.Value, true, nil
+		}
+	}
+	return "", false, errNoCredentials
+}
+
+// middlewareAuth validates the access token once and puts the Principal in
+// the request context for next. The token comes from the Authorization
+// header or, in cookie mode, the session cookie; since browsers send cookies
+// on cross-site requests too, unsafe methods authenticated by cookie must
+// also pass the CSRF check. With required=false a request without
+// credentials passes through anonymously, but a bad token is still rejected
+// rather than silently downgraded.
+func (cfg *apiConfig) middlewareAuth(required bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, fromCookie, err := cfg.requestToken(r)
+		if errors.Is(err, errNoCredentials) && !required {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			respondWithAuthErr(w, err)
+			return
+		}
+
+		// the browser attaches cookies to cross-site requests too
+		if fromCookie && !isSafeMethod(r.Method) && !checkCSRF(r) {
+			respondWithErr(w, http.StatusForbidden, "missing or invalid CSRF token", nil)
+			return
+		}
+
+		var p auth.Principal
+		if !fromCookie && auth.IsPersonalAccessToken(token) {
+			p, err = cfg.authenticatePAT(r.Context(), token)
+		} else {
+			p, err = cfg.keyring.ParseAccessToken(token)
+			if err == nil && p.ClientID != "" {
+				p, err = cfg.authenticateOAuthAccessToken(r.Context(), p)
+			}
+			if err == nil && cfg.revocations.Revoked(p) {
+				err = auth.ErrTokenRevoked
+			}
+		}
+		if err != nil {
+			respondWithAuthErr(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+	})
+}
+
+func (cfg *apiConfig) requireAuth(next http.Handler) http.Handler {
+	return cfg.middlewareAuth(true, next)
+}
+
+func (cfg *apiConfig) optionalAuth(next http.Handler) http.Handler {
+	return cfg.middlewareAuth(false, next)
+}
+
+// requireAuthScope is requireAuth plus a scope check, the usual wrapping for
+// protected routes.
+func (cfg *apiConfig) requireAuthScope(scope string, next http.Handler) http.Handler {
+	return cfg.requireAuth(cfg.requireScope(scope, next))
+}
+
+// requireScope rejects authenticated callers whose token lacks scope.
+// Anonymous requests are left to whatever auth middleware wraps this.
+func (cfg *apiConfig) requireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := auth.PrincipalFromContext(r.Context()); ok && !p.HasScope(scope) {
+			respondWithScopeErr(w, scope)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin lets through only users listed in ADMIN_USER_IDS, and only
+// with a full login token: a PAT or OAuth token of an admin is not enough.
+func (cfg *apiConfig) requireAdmin(next http.Handler) http.Handler {
+	return cfg.requireAuthScope(auth.ScopeAccount, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.admins[principal(r).UserID] {
+			respondWithErr(w, http.StatusForbidden, "Admins only", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sharath070/Chirpy/internal/migrate"
+)
+
+// runMigrateCommand handles `chirpy migrate up|down|status`.
+func runMigrateCommand(m *migrate.Migrator, args []string) {
+	if len(args) != 1 {
+		log.Fatal("usage: chirpy migrate up|down|status")
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, mig := range applied {
+			log.Printf("applied %s", mig.Name)
+		}
+		log.Printf("schema is at version %d", m.Latest())
+
+	case "down":
+		mig, err := m.Down(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("rolled back %s", mig.Name)
+
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "APPLIED AT\tMIGRATION")
+		for _, s := range statuses {
+			at := "pending"
+			if s.Applied {
+				at = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", at, s.Name)
+		}
+		tw.Flush()
+
+	default:
+		log.Fatalf("unknown migrate command %q, want up, down or status", args[0])
+	}
+}
+
+// migrateOnStart brings the schema up to date, or with AUTO_MIGRATE=false
+// only checks it: serving against an old schema fails later, one query at
+// a time, so refuse to start instead.
+func migrateOnStart(m *migrate.Migrator) {
+	ctx := context.Background()
+
+	if envString("AUTO_MIGRATE", "true") == "true" {
+		applied, err := m.Up(ctx)
+		if err != nil {
+			log.Fatal("Failed to migrate database: ", err)
+		}
+		for _, mig := range applied {
+			log.Printf("applied migration %s", mig.Name)
+		}
+		return
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		log.Fatal("Failed to check database schema: ", err)
+	}
+	if len(pending) > 0 {
+		log.Fatalf("database schema is behind: %d pending migrations starting at %s; run `chirpy migrate up`", len(pending), pending[0].Name)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharath070/Chirpy/internal/database"
+)
+
+const (
+	defaultNotificationsLimit = 50
+	maxNotificationsLimit     = 200
+)
+
+// Notification types.
+const (
+	// one of the user's webhooks was turned off after failing too often
+	notificationWebhookDisabled = "webhook.disabled"
+)
+
+type notification struct {
+	Id        uuid.UUID       `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	UserId    uuid.UUID       `json:"user_id"`
+	Type      string          `json:"type"`
+	ActorId   *uuid.UUID      `json:"actor_id,omitempty"`
+	ChirpId   *uuid.UUID      `json:"chirp_id,omitempty"`
+	Data      json.RawMessage `json:"data"`
+	Read      bool            `json:"read"`
+	ReadAt    *time.Time      `json:"read_at,omitempty"`
+}
+
+func notificationResp(n database.Notification) notification {
+	res := notification{
+		Id:        n.ID,
+		CreatedAt: n.CreatedAt,
+		UserId:    n.UserID,
+		Type:      n.Type,
+		Data:      n.Data,
+		Read:      n.ReadAt.Valid,
+		ReadAt:    nullTimePtr(n.ReadAt),
+	}
+	if n.ActorID.Valid {
+		res.ActorId = &n.ActorID.UUID
+	}
+	if n.ChirpID.Valid {
+		res.ChirpId = &n.ChirpID.UUID
+	}
+	return res
+}
+
+// notify records a notification for userID and pushes it to their open
+// WebSockets, on whichever instance they are. Nobody is notified about their
+// own actions. actorID and chirpID may be uuid.Nil; data is whatever the
+// client needs to render it.
+func (cfg *apiConfig) notify(ctx context.Context, userID uuid.UUID, typ string, actorID, chirpID uuid.UUID, data any) error {
+	if actorID == userID {
+		return nil
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	n, err := cfg.dbQueries.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID:  userID,
+		Type:    typ,
+		ActorID: uuid.NullUUID{UUID: actorID, Valid: actorID != uuid.Nil},
+		ChirpID: uuid.NullUUID{UUID: chirpID, Valid: chirpID != uuid.Nil},
+		Data:    raw,
+	})
+	if err != nil {
+		return err
+	}
+
+	cfg.publish(ctx, eventNotificationCreated, notificationResp(n))
+	return nil
+}
+
+// handleListNotifications returns the caller's newest notifications, only
+// the unread ones with ?unread=true, and how many are unread in total.
+func (cfg *apiConfig) handleListNotifications(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+	q := r.URL.Query()
+
+	unreadOnly := false
+	if s := q.Get("unread"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			respondWithErr(w, http.StatusBadRequest, "unread must be true or false", err)
+			return
+		}
+		unreadOnly = b
+	}
+
+	limit := defaultNotificationsLimit
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxNotificationsLimit {
+			respondWithErr(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxNotificationsLimit), err)
+			return
+		}
+		limit = n
+	}
+
+	list, err := cfg.dbQueries.ListNotifications(r.Context(), database.ListNotificationsParams{
+		UserID:     userID,
+		UnreadOnly: unreadOnly,
+		RowLimit:   int32(limit),
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't list notifications", err)
+		return
+	}
+	unread, err := cfg.dbQueries.CountUnreadNotifications(r.Context(), userID)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't count notifications", err)
+		return
+	}
+
+	res := []notification{}
+	for _, n := range list {
+		res = append(res, notificationResp(n))
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, http.StatusOK, struct {
+		UnreadCount   int64          `json:"unread_count"`
+		Notifications []notification `json:"notifications"`
+	}{
+		UnreadCount:   unread,
+		Notifications: res,
+	})
+}
+
+type markNotificationsReadParams struct {
+	Ids []uuid.UUID `json:"ids" validate:"max=500"`
+	All bool        `json:"all"`
+}
+
+// handleMarkNotificationsRead marks the given notifications read, or all of
+// them with {"all": true}. Ids that aren't the caller's, or are already read,
+// are skipped.
+func (cfg *apiConfig) handleMarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+
+	params, err := decodeJSON[markNotificationsReadParams](w, r)
+	if err != nil {
+		respondWithDecodeErr(w, err)
+		return
+	}
+	if params.All == (len(params.Ids) > 0) {
+		respondWithErr(w, http.StatusBadRequest, "send either ids or all: true", nil)
+		return
+	}
+
+	var n int64
+	if params.All {
+		n, err = cfg.dbQueries.MarkAllNotificationsRead(r.Context(), userID)
+	} else {
+		n, err = cfg.dbQueries.MarkNotificationsRead(r.Context(), database.MarkNotificationsReadParams{
+			UserID: userID,
+			Ids:    params.Ids,
+		})
+	}
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't mark notifications read", err)
+		return
+	}
+	unread, err := cfg.dbQueries.CountUnreadNotifications(r.Context(), userID)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't count notifications", err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, struct {
+		Marked      int64 `json:"marked"`
+		UnreadCount int64 `json:"unread_count"`
+	}{
+		Marked:      n,
+		UnreadCount: unread,
+	})
+}
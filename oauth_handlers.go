@@ -0,0 +1,736 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharath070/Chirpy/internal/auth"
+	"github.com/sharath070/Chirpy/internal/database"
+	"github.com/sharath070/Chirpy/internal/validate"
+)
+
+/*
+	Chirpy as an OAuth2 authorization server for third party apps:
+
+		GET  /oauth/authorize          what apps send the browser to; bounces
+		                               to the consent page under /app/
+		GET  /api/oauth/authorize      consent page asks what's being requested
+		POST /api/oauth/authorize      user allows or denies, gets the app's
+		                               redirect_uri back with a code or error
+		POST /api/oauth/token          app swaps code + PKCE verifier (or a
+		                               refresh token) for tokens
+		POST /api/oauth/introspect     RFC 7662
+		POST /api/oauth/revoke         RFC 7009
+
+	Access tokens are our normal JWTs with the app's scopes, client_id, and
+	the grant id as sid. Every request made with one re-checks the grant, so
+	revoking it (or deleting the app) takes effect immediately.
+*/
+
+const (
+	authorizationCodeTTL = 5 * time.Minute
+	oauthAccessTokenTTL  = time.Hour
+	oauthGrantTTL        = 90 * 24 * time.Hour
+)
+
+var scopeDescriptions = map[string]string{
+	auth.ScopeChirpsRead:    "Read chirps",
+	auth.ScopeChirpsWrite:   "Post and delete chirps as you",
+	auth.ScopeNotifications: "Read your notifications",
+}
+
+type createOAuthClientParams struct {
+	Name         string   `json:"name" validate:"required,max=100"`
+	RedirectURIs []string `json:"redirect_uris" validate:"required,min=1,max=10"`
+	Scopes       []string `json:"scopes" validate:"required,min=1"`
+	// confidential clients run on a server and can keep a secret; the rest
+	// (SPAs, mobile apps) are public and rely on PKCE alone
+	Confidential bool `json:"confidential"`
+}
+
+type oauthClientResp struct {
+	ClientID     uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+	// only set in the response to registering the client
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func newOAuthClientResp(c database.OauthClient) oauthClientResp {
+	return oauthClientResp{
+		ClientID:     c.ID,
+		Name:         c.Name,
+		RedirectURIs: c.RedirectUris,
+		Scopes:       c.Scopes,
+		Confidential: c.SecretHash.Valid,
+		CreatedAt:    c.CreatedAt,
+	}
+}
+
+func (cfg *apiConfig) handleCreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeJSON[createOAuthClientParams](w, r)
+	if err != nil {
+		respondWithDecodeErr(w, err)
+		return
+	}
+
+	var fieldErrs validate.Errors
+	for _, uri := range params.RedirectURIs {
+		if err := auth.CheckRedirectURI(uri); err != nil {
+			fieldErrs = append(fieldErrs, validate.FieldError{Field: "redirect_uris", Message: err.Error()})
+			break
+		}
+	}
+	scopes, err := auth.CheckGrantableScopes(params.Scopes)
+	if err != nil {
+		fieldErrs = append(fieldErrs, validate.FieldError{Field: "scopes", Message: err.Error()})
+	}
+	if len(fieldErrs) > 0 {
+		respondWithDecodeErr(w, fieldErrs)
+		return
+	}
+
+	var secret string
+	var secretHash sql.NullString
+	if params.Confidential {
+		secret, err = auth.MakeClientSecret()
+		if err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "Couldn't create client secret", err)
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashOpaqueToken(secret), Valid: true}
+	}
+
+	client, err := cfg.dbQueries.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		UserID:       principal(r).UserID,
+		Name:         params.Name,
+		RedirectUris: params.RedirectURIs,
+		SecretHash:   secretHash,
+		Scopes:       scopes,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't register client", err)
+		return
+	}
+
+	res := newOAuthClientResp(client)
+	res.ClientSecret = secret
+	respondWithJson(w, http.StatusCreated, res)
+}
+
+func (cfg *apiConfig) handleListOAuthClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := cfg.dbQueries.ListOAuthClients(r.Context(), principal(r).UserID)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't list clients", err)
+		return
+	}
+
+	clientsRes := []oauthClientResp{}
+	for _, c := range clients {
+		clientsRes = append(clientsRes, newOAuthClientResp(c))
+	}
+
+	respondWithJson(w, http.StatusOK, clientsRes)
+}
+
+// handleDeleteOAuthClient also kills every grant and token the app holds,
+// through the foreign key cascade.
+func (cfg *apiConfig) handleDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "invalid uuid format", err)
+		return
+	}
+
+	n, err := cfg.dbQueries.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:     id,
+		UserID: principal(r).UserID,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't delete client", err)
+		return
+	}
+	if n == 0 {
+		respondWithErr(w, http.StatusNotFound, "Client not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// oauthGrantResp is an app the user has authorized.
+type oauthGrantResp struct {
+	Id         uuid.UUID `json:"id"`
+	ClientID   uuid.UUID `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// handleListOAuthGrants lists the apps the caller has authorized and that
+// can still get tokens.
+func (cfg *apiConfig) handleListOAuthGrants(w http.ResponseWriter, r *http.Request) {
+	grants, err := cfg.dbQueries.ListUserOAuthGrants(r.Context(), principal(r).UserID)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't list authorized apps", err)
+		return
+	}
+
+	grantsRes := []oauthGrantResp{}
+	for _, g := range grants {
+		grantsRes = append(grantsRes, oauthGrantResp{
+			Id:         g.ID,
+			ClientID:   g.ClientID,
+			ClientName: g.ClientName,
+			Scopes:     g.Scopes,
+			CreatedAt:  g.CreatedAt,
+			LastUsedAt: g.LastUsedAt,
+			ExpiresAt:  g.ExpiresAt,
+		})
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, http.StatusOK, grantsRes)
+}
+
+// handleRevokeOAuthGrant takes an app's access away. Its refresh token stops
+// working right away, and so do its access tokens, which are checked against
+// the grant on every request.
+func (cfg *apiConfig) handleRevokeOAuthGrant(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("grantID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "invalid uuid format", err)
+		return
+	}
+
+	n, err := cfg.dbQueries.RevokeUserOAuthGrant(r.Context(), database.RevokeUserOAuthGrantParams{
+		ID:     id,
+		UserID: principal(r).UserID,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't revoke authorized app", err)
+		return
+	}
+	if n == 0 {
+		respondWithErr(w, http.StatusNotFound, "Authorized app not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeParams are the RFC 6749 4.1.1 request parameters, plus the
+// user's decision when posted back from the consent page.
+type authorizeParams struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approve             bool   `json:"approve"`
+}
+
+func authorizeParamsFromQuery(q url.Values) authorizeParams {
+	return authorizeParams{
+		ResponseType:        q.Get("response_type"),
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+	}
+}
+
+// authorizeError is an error for the app, sent back to its redirect_uri.
+type authorizeError struct {
+	Code        string
+	Description string
+}
+
+func (e authorizeError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// untrustedClientError means the client or redirect_uri can't be trusted,
+// so it's only ever shown to the user. Any other error from checkAuthorize
+// is ours.
+type untrustedClientError string
+
+func (e untrustedClientError) Error() string {
+	return string(e)
+}
+
+type authorizeRequest struct {
+	client      database.OauthClient
+	redirectURI string
+	scopes      []string
+}
+
+func (cfg *apiConfig) checkAuthorize(ctx context.Context, params authorizeParams) (authorizeRequest, error) {
+	clientID, err := uuid.Parse(params.ClientID)
+	if err != nil {
+		return authorizeRequest{}, untrustedClientError("unknown client_id")
+	}
+	client, err := cfg.dbQueries.GetOAuthClient(ctx, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return authorizeRequest{}, untrustedClientError("unknown client_id")
+	}
+	if err != nil {
+		return authorizeRequest{}, err
+	}
+	// exact match only, see auth.CheckRedirectURI
+	if !slices.Contains(client.RedirectUris, params.RedirectURI) {
+		return authorizeRequest{}, untrustedClientError("redirect_uri is not registered for this client")
+	}
+
+	req := authorizeRequest{client: client, redirectURI: params.RedirectURI}
+	if params.ResponseType != "code" {
+		return req, authorizeError{"unsupported_response_type", "only response_type=code is supported"}
+	}
+	if params.CodeChallenge == "" || params.CodeChallengeMethod != "S256" {
+		return req, authorizeError{"invalid_request", "PKCE with code_challenge_method=S256 is required"}
+	}
+
+	if params.Scope == "" {
+		req.scopes = client.Scopes
+	} else {
+		req.scopes, err = auth.ParseScope(params.Scope)
+		if err != nil {
+			return req, authorizeError{"invalid_scope", err.Error()}
+		}
+	}
+	for _, s := range req.scopes {
+		if !slices.Contains(client.Scopes, s) {
+			return req, authorizeError{"invalid_scope", fmt.Sprintf("client may not request %q", s)}
+		}
+	}
+	// a token with no scopes would read as unrestricted
+	if len(req.scopes) == 0 {
+		return req, authorizeError{"invalid_scope", "at least one scope is required"}
+	}
+
+	return req, nil
+}
+
+func authorizeRedirect(redirectURI string, q url.Values) string {
+	sep := "?"
+	if strings.Contains(redirectURI, "?") {
+		sep = "&"
+	}
+	return redirectURI + sep + q.Encode()
+}
+
+// handleOAuthAuthorize is the URL apps send users to. The consent page
+// itself is static and talks to the API with the user's own login.
+func (cfg *apiConfig) handleOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/app/oauth/consent.html?"+r.URL.RawQuery, http.StatusFound)
+}
+
+type scopeResp struct {
+	Scope       string `json:"scope"`
+	Description string `json:"description"`
+}
+
+// handleDescribeAuthorize tells the consent page what the app is asking for.
+func (cfg *apiConfig) handleDescribeAuthorize(w http.ResponseWriter, r *http.Request) {
+	params := authorizeParamsFromQuery(r.URL.Query())
+
+	req, err := cfg.checkAuthorize(r.Context(), params)
+	var authErr authorizeError
+	var clientErr untrustedClientError
+	if errors.As(err, &clientErr) {
+		respondWithErr(w, http.StatusBadRequest, "Invalid authorization request: "+clientErr.Error(), nil)
+		return
+	}
+	if err != nil && !errors.As(err, &authErr) {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't check authorization request", err)
+		return
+	}
+	if err != nil {
+		respondWithJson(w, http.StatusBadRequest, struct {
+			Error      string `json:"error"`
+			RedirectTo string `json:"redirect_to"`
+		}{
+			Error: authErr.Description,
+			RedirectTo: authorizeRedirect(req.redirectURI, url.Values{
+				"error":             {authErr.Code},
+				"error_description": {authErr.Description},
+				"state":             {params.State},
+			}),
+		})
+		return
+	}
+
+	scopes := []scopeResp{}
+	for _, s := range req.scopes {
+		scopes = append(scopes, scopeResp{Scope: s, Description: scopeDescriptions[s]})
+	}
+
+	respondWithJson(w, http.StatusOK, struct {
+		ClientID    uuid.UUID   `json:"client_id"`
+		ClientName  string      `json:"client_name"`
+		RedirectURI string      `json:"redirect_uri"`
+		Scopes      []scopeResp `json:"scopes"`
+	}{
+		ClientID:    req.client.ID,
+		ClientName:  req.client.Name,
+		RedirectURI: req.redirectURI,
+		Scopes:      scopes,
+	})
+}
+
+// handleApproveAuthorize records the user's decision and answers with where
+// to send the browser: back to the app with a code, or with access_denied.
+func (cfg *apiConfig) handleApproveAuthorize(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeJSON[authorizeParams](w, r)
+	if err != nil {
+		respondWithDecodeErr(w, err)
+		return
+	}
+
+	q := url.Values{}
+	if params.State != "" {
+		q.Set("state", params.State)
+	}
+
+	req, err := cfg.checkAuthorize(r.Context(), params)
+	var authErr authorizeError
+	var clientErr untrustedClientError
+	switch {
+	case errors.As(err, &authErr):
+		q.Set("error", authErr.Code)
+		q.Set("error_description", authErr.Description)
+	case errors.As(err, &clientErr):
+		respondWithErr(w, http.StatusBadRequest, "Invalid authorization request: "+clientErr.Error(), nil)
+		return
+	case err != nil:
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't check authorization request", err)
+		return
+	case !params.Approve:
+		q.Set("error", "access_denied")
+	default:
+		code, err := auth.MakeOpaqueToken()
+		if err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "Couldn't create authorization code", err)
+			return
+		}
+
+		err = cfg.dbQueries.CreateAuthorizationCode(r.Context(), database.CreateAuthorizationCodeParams{
+			CodeHash:      auth.HashOpaqueToken(code),
+			ExpiresAt:     time.Now().Add(authorizationCodeTTL),
+			ClientID:      req.client.ID,
+			UserID:        principal(r).UserID,
+			RedirectUri:   req.redirectURI,
+			Scopes:        req.scopes,
+			CodeChallenge: params.CodeChallenge,
+		})
+		if err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "Couldn't create authorization code", err)
+			return
+		}
+		q.Set("code", code)
+	}
+
+	respondWithJson(w, http.StatusOK, struct {
+		RedirectTo string `json:"redirect_to"`
+	}{
+		RedirectTo: authorizeRedirect(req.redirectURI, q),
+	})
+}
+
+// respondWithOAuthErr uses the RFC 6749 5.2 error shape rather than ours,
+// since that's what OAuth client libraries parse.
+func respondWithOAuthErr(w http.ResponseWriter, code int, oauthErr, desc string, err error) {
+	if err != nil {
+		log.Println(err)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, code, struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description,omitempty"`
+	}{
+		Error:            oauthErr,
+		ErrorDescription: desc,
+	})
+}
+
+var errInvalidClient = errors.New("client authentication failed")
+
+// authenticateOAuthClient reads client credentials from HTTP Basic auth or
+// the form body (RFC 6749 2.3.1). Public clients only send their id.
+func (cfg *apiConfig) authenticateOAuthClient(r *http.Request) (database.OauthClient, error) {
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		// Basic credentials are form-encoded before base64
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+
+	clientID, err := uuid.Parse(id)
+	if err != nil {
+		return database.OauthClient{}, errInvalidClient
+	}
+	client, err := cfg.dbQueries.GetOAuthClient(r.Context(), clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.OauthClient{}, errInvalidClient
+	}
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+
+	if client.SecretHash.Valid {
+		hash := auth.HashOpaqueToken(secret)
+		if secret == "" || subtle.ConstantTimeCompare([]byte(hash), []byte(client.SecretHash.String)) != 1 {
+			return database.OauthClient{}, errInvalidClient
+		}
+	} else if secret != "" {
+		return database.OauthClient{}, errInvalidClient
+	}
+
+	return client, nil
+}
+
+func (cfg *apiConfig) parseOAuthForm(w http.ResponseWriter, r *http.Request) (database.OauthClient, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthErr(w, http.StatusBadRequest, "invalid_request", "body must be application/x-www-form-urlencoded", err)
+		return database.OauthClient{}, false
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if errors.Is(err, errInvalidClient) {
+		if _, _, basic := r.BasicAuth(); basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		}
+		respondWithOAuthErr(w, http.StatusUnauthorized, "invalid_client", err.Error(), nil)
+		return database.OauthClient{}, false
+	}
+	if err != nil {
+		respondWithOAuthErr(w, http.StatusInternalServerError, "server_error", "", err)
+		return database.OauthClient{}, false
+	}
+	return client, true
+}
+
+// errInvalidGrant is an invalid_grant answer from inside a token
+// transaction; the text is the error_description.
+type errInvalidGrant string
+
+func (e errInvalidGrant) Error() string { return "invalid_grant: " + string(e) }
+
+func (cfg *apiConfig) handleOAuthToken(w http.ResponseWriter, r *http.Request) {
+	client, ok := cfg.parseOAuthForm(w, r)
+	if !ok {
+		return
+	}
+
+	var grant database.OauthGrant
+	refreshToken, err := auth.MakeOpaqueToken()
+	if err != nil {
+		respondWithOAuthErr(w, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+		// the code is only spent if a grant comes out of it
+		err = cfg.tx.InTx(r.Context(), func(q *database.Queries) error {
+			code, err := q.UseAuthorizationCode(r.Context(), database.UseAuthorizationCodeParams{
+				CodeHash: auth.HashOpaqueToken(r.PostFormValue("code")),
+				ClientID: client.ID,
+			})
+			if errors.Is(err, sql.ErrNoRows) {
+				return errInvalidGrant("code is invalid, expired or already used")
+			}
+			if err != nil {
+				return err
+			}
+			if r.PostFormValue("redirect_uri") != code.RedirectUri {
+				return errInvalidGrant("redirect_uri does not match the authorization request")
+			}
+			if !auth.VerifyPKCE(r.PostFormValue("code_verifier"), code.CodeChallenge) {
+				return errInvalidGrant("code_verifier does not match code_challenge")
+			}
+
+			grant, err = q.CreateOAuthGrant(r.Context(), database.CreateOAuthGrantParams{
+				ClientID:         client.ID,
+				UserID:           code.UserID,
+				Scopes:           code.Scopes,
+				RefreshTokenHash: auth.HashOpaqueToken(refreshToken),
+				ExpiresAt:        time.Now().Add(oauthGrantTTL),
+			})
+			return err
+		})
+		var invalid errInvalidGrant
+		if errors.As(err, &invalid) {
+			respondWithOAuthErr(w, http.StatusBadRequest, "invalid_grant", string(invalid), nil)
+			return
+		}
+		if err != nil {
+			respondWithOAuthErr(w, http.StatusInternalServerError, "server_error", "", err)
+			return
+		}
+
+	case "refresh_token":
+		// the old refresh token stops working as soon as it's used
+		grant, err = cfg.dbQueries.RotateOAuthGrant(r.Context(), database.RotateOAuthGrantParams{
+			NewRefreshTokenHash: auth.HashOpaqueToken(refreshToken),
+			RefreshTokenHash:    auth.HashOpaqueToken(r.PostFormValue("refresh_token")),
+			ClientID:            client.ID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithOAuthErr(w, http.StatusBadRequest, "invalid_grant", "refresh token is invalid, expired or revoked", nil)
+			return
+		}
+		if err != nil {
+			respondWithOAuthErr(w, http.StatusInternalServerError, "server_error", "", err)
+			return
+		}
+
+	default:
+		respondWithOAuthErr(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token", nil)
+		return
+	}
+
+	accessToken, err := cfg.keyring.MakeAccessToken(auth.Principal{
+		UserID:    grant.UserID,
+		Scopes:    grant.Scopes,
+		SessionID: grant.ID,
+		ClientID:  client.ID.String(),
+	}, oauthAccessTokenTTL)
+	if err != nil {
+		respondWithOAuthErr(w, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, http.StatusOK, struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(grant.Scopes, " "),
+	})
+}
+
+// oauthGrantForToken finds the live grant behind an access or refresh
+// token, as long as it belongs to client.
+func (cfg *apiConfig) oauthGrantForToken(ctx context.Context, client database.OauthClient, token string) (database.OauthGrant, auth.Principal, bool) {
+	if p, err := cfg.keyring.ParseAccessToken(token); err == nil {
+		if p.ClientID != client.ID.String() {
+			return database.OauthGrant{}, auth.Principal{}, false
+		}
+		grant, err := cfg.dbQueries.GetActiveOAuthGrant(ctx, p.SessionID)
+		return grant, p, err == nil
+	}
+
+	grant, err := cfg.dbQueries.GetActiveOAuthGrantByRefreshHash(ctx, auth.HashOpaqueToken(token))
+	if err != nil || grant.ClientID != client.ID {
+		return database.OauthGrant{}, auth.Principal{}, false
+	}
+	return grant, auth.Principal{}, true
+}
+
+// handleOAuthIntrospect answers for tokens issued to the calling client;
+// anything else, including other apps' tokens, is just inactive.
+func (cfg *apiConfig) handleOAuthIntrospect(w http.ResponseWriter, r *http.Request) {
+	client, ok := cfg.parseOAuthForm(w, r)
+	if !ok {
+		return
+	}
+
+	type introspectResp struct {
+		Active    bool   `json:"active"`
+		Scope     string `json:"scope,omitempty"`
+		ClientID  string `json:"client_id,omitempty"`
+		Sub       string `json:"sub,omitempty"`
+		TokenType string `json:"token_type,omitempty"`
+		Exp       int64  `json:"exp,omitempty"`
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	grant, p, ok := cfg.oauthGrantForToken(r.Context(), client, r.PostFormValue("token"))
+	if !ok {
+		respondWithJson(w, http.StatusOK, introspectResp{Active: false})
+		return
+	}
+
+	res := introspectResp{
+		Active:    true,
+		Scope:     strings.Join(grant.Scopes, " "),
+		ClientID:  client.ID.String(),
+		Sub:       grant.UserID.String(),
+		TokenType: "refresh_token",
+		Exp:       grant.ExpiresAt.Unix(),
+	}
+	if p.ClientID != "" {
+		res.TokenType = "access_token"
+		res.Exp = p.ExpiresAt.Unix()
+	}
+	respondWithJson(w, http.StatusOK, res)
+}
+
+// handleOAuthRevoke revokes the whole grant, whichever of its tokens is
+// presented. Unknown tokens still get 200, as RFC 7009 asks.
+func (cfg *apiConfig) handleOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	client, ok := cfg.parseOAuthForm(w, r)
+	if !ok {
+		return
+	}
+
+	grant, _, ok := cfg.oauthGrantForToken(r.Context(), client, r.PostFormValue("token"))
+	if ok {
+		_, err := cfg.dbQueries.RevokeOAuthGrant(r.Context(), database.RevokeOAuthGrantParams{
+			ID:       grant.ID,
+			ClientID: client.ID,
+		})
+		if err != nil {
+			respondWithOAuthErr(w, http.StatusInternalServerError, "server_error", "", err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// authenticateOAuthAccessToken checks that the grant behind a third party
+// app's token is still live. The grant's scopes win over the token's, so
+// narrowing a grant applies to tokens already handed out.
+func (cfg *apiConfig) authenticateOAuthAccessToken(ctx context.Context, p auth.Principal) (auth.Principal, error) {
+	grant, err := cfg.dbQueries.GetActiveOAuthGrant(ctx, p.SessionID)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	if grant.ClientID.String() != p.ClientID || grant.UserID != p.UserID {
+		return auth.Principal{}, sql.ErrNoRows
+	}
+
+	p.Scopes = append([]string{}, grant.Scopes...)
+	return p, nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharath070/Chirpy/internal/auth"
+	"github.com/sharath070/Chirpy/internal/database"
+	"github.com/sharath070/Chirpy/internal/oidc"
+)
+
+const (
+	oidcStateCookie = "chirpy_oidc_state"
+	oidcLoginTTL    = 10 * time.Minute
+)
+
+// handleOIDCLogin starts a sign-in with the external IdP. The state, nonce
+// and PKCE verifier stay on our side; the browser only carries the state,
+// in the redirect and in a cookie, so a callback can't be replayed into
+// someone else's browser.
+func (cfg *apiConfig) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	var values [3]string
+	for i := range values {
+		v, err := oidc.NewVerifier()
+		if err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "Couldn't start login", err)
+			return
+		}
+		values[i] = v
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	err := cfg.dbQueries.CreateOIDCLoginState(r.Context(), database.CreateOIDCLoginStateParams{
+		StateHash:    auth.HashOpaqueToken(state),
+		ExpiresAt:    time.Now().Add(oidcLoginTTL),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't start login", err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc",
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   cfg.secureCookies(),
+		// Lax, not Strict: the callback is a top-level navigation from the IdP
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, cfg.oidc.AuthCodeURL(state, nonce, verifier), http.StatusFound)
+}
+
+func (cfg *apiConfig) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if idpErr := q.Get("error"); idpErr != "" {
+		respondWithErr(w, http.StatusUnauthorized, "Sign-in was cancelled or denied: "+idpErr, nil)
+		return
+	}
+
+	state := q.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		respondWithErr(w, http.StatusBadRequest, "Login state doesn't match, start the sign-in again", err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/auth/oidc", MaxAge: -1})
+
+	login, err := cfg.dbQueries.ConsumeOIDCLoginState(r.Context(), auth.HashOpaqueToken(state))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusBadRequest, "Login expired, start the sign-in again", nil)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't look up login state", err)
+		return
+	}
+
+	tok, err := cfg.oidc.Exchange(r.Context(), q.Get("code"), login.CodeVerifier)
+	if err != nil {
+		respondWithErr(w, http.StatusUnauthorized, "Couldn't redeem the authorization code", err)
+		return
+	}
+
+	claims, err := cfg.oidc.VerifyIDToken(r.Context(), tok.IDToken, login.Nonce)
+	if err != nil {
+		respondWithErr(w, http.StatusUnauthorized, "Identity provider returned an invalid id token", err)
+		return
+	}
+
+	user, err := cfg.userForIdentity(r.Context(), claims)
+	if errors.Is(err, errUnverifiedIdentityEmail) {
+		respondWithErr(w, http.StatusForbidden, "Your identity provider hasn't verified your email address", nil)
+		return
+	}
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't sign in", err)
+		return
+	}
+
+	// a browser landed here from the IdP; in cookie mode give it a session
+	// and send it on to the app instead of showing it JSON
+	if cfg.cookieSessions {
+		twoFactor, err := cfg.twoFactorEnabled(r.Context(), user.ID)
+		if err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "Couldn't check two-factor status", err)
+			return
+		}
+		if !twoFactor {
+			token, refreshToken, err := cfg.startSession(r, user.ID)
+			if err == nil {
+				err = cfg.setSessionCookies(w, token, refreshToken)
+			}
+			if err != nil {
+				respondWithErr(w, http.StatusInternalServerError, "error creating session", err)
+				return
+			}
+			http.Redirect(w, r, "/app/", http.StatusSeeOther)
+			return
+		}
+	}
+
+	cfg.completeLogin(w, r, user)
+}
+
+var errUnverifiedIdentityEmail = errors.New("identity provider email is not verified")
+
+// userForIdentity finds the Chirpy user behind an IdP identity. Identities
+// we've seen before map straight to their user. New ones are linked to the
+// account with the same email, or get a fresh passwordless account, but only
+// when the IdP vouches for the address; otherwise anyone able to register
+// at the IdP with a victim's email would walk into their Chirpy account.
+func (cfg *apiConfig) userForIdentity(ctx context.Context, claims oidc.Claims) (database.User, error) {
+	var user database.User
+	var revoked bool
+	err := cfg.tx.InTx(ctx, func(q *database.Queries) error {
+		var err error
+		user, revoked, err = cfg.linkIdentity(ctx, q, claims)
+		return err
+	})
+	if err == nil && revoked {
+		cfg.publishAllSessionsRevoked(ctx, user.ID, uuid.Nil)
+	}
+	return user, err
+}
+
+// linkIdentity is userForIdentity's unit of work; it runs in one
+// transaction so a half-linked account can't be left behind. It reports
+// whether it revoked the account's existing sessions.
+func (cfg *apiConfig) linkIdentity(ctx context.Context, q *database.Queries, claims oidc.Claims) (database.User, bool, error) {
+	identity, err := q.GetUserIdentity(ctx, database.GetUserIdentityParams{
+		Provider: cfg.oidcProvider,
+		Subject:  claims.Subject,
+	})
+	if err == nil {
+		err = q.TouchUserIdentity(ctx, database.TouchUserIdentityParams{
+			ID:    identity.ID,
+			Email: claims.Email,
+		})
+		if err != nil {
+			return database.User{}, false, err
+		}
+		user, err := q.GetUserByID(ctx, identity.UserID)
+		return user, false, err
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, false, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return database.User{}, false, errUnverifiedIdentityEmail
+	}
+
+	revoked := false
+	user, err := q.GetUserByEmail(ctx, claims.Email)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		user, err = q.CreateUser(ctx, database.CreateUserParams{
+			Email:          claims.Email,
+			HashedPassword: auth.UnusablePasswordHash,
+		})
+		if err != nil {
+			return database.User{}, false, err
+		}
+	case err != nil:
+		return database.User{}, false, err
+	case !user.EmailVerifiedAt.Valid:
+		// someone may have signed up with this address before its owner
+		// showed up; drop their password, sessions, tokens, app grants and
+		// second factor so the account is the owner's alone from here on
+		err = q.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+			ID:             user.ID,
+			HashedPassword: auth.UnusablePasswordHash,
+		})
+		if err != nil {
+			return database.User{}, false, err
+		}
+		if err := q.RevokeAllCredentials(ctx, user.ID); err != nil {
+			return database.User{}, false, err
+		}
+		revoked = true
+	}
+
+	if !user.EmailVerifiedAt.Valid {
+		if _, err := q.MarkEmailVerified(ctx, database.MarkEmailVerifiedParams{
+			ID:    user.ID,
+			Email: user.Email,
+		}); err != nil {
+			return database.User{}, false, err
+		}
+		user.EmailVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+
+	_, err = q.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		UserID:   user.ID,
+		Provider: cfg.oidcProvider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		return database.User{}, false, err
+	}
+
+	log.Printf("linked %s identity %s to user %s", cfg.oidcProvider, claims.Subject, user.ID)
+	return user, revoked, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharath070/Chirpy/internal/auth"
+	"github.com/sharath070/Chirpy/internal/database"
+)
+
+// accessTokenTTL is how long a login access token lives. Revoking its
+// session takes effect before that through cfg.revocations.
+const accessTokenTTL = time.Hour
+
+// startSession creates a refresh token row for the device making r and an
+// access token tied to it. Only the hash of the refresh token is stored, the
+// plaintext is returned once here and never again.
+func (cfg *apiConfig) startSession(r *http.Request, userID uuid.UUID) (accessToken, refreshToken string, err error) {
+	refreshToken, err = auth.MakeRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	session, err := cfg.dbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash: auth.HashRefreshToken(refreshToken),
+		UserID:    userID,
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	accessToken, err = cfg.keyring.MakeAccessToken(auth.Principal{
+		UserID:    userID,
+		SessionID: session.ID,
+	}, accessTokenTTL)
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// respondWithSession starts a session for user and hands over the tokens:
+// in the body, or as cookies when the client asked for cookie mode.
+func (cfg *apiConfig) respondWithSession(w http.ResponseWriter, r *http.Request, user database.User) {
+	token, refreshToken, err := cfg.startSession(r, user.ID)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "error creating session", err)
+		return
+	}
+
+	res := userResp{
+		Id:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+	}
+	if cfg.wantsCookieSession(r) {
+		if err := cfg.setSessionCookies(w, token, refreshToken); err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "error creating session", err)
+			return
+		}
+	} else {
+		res.Token = token
+		res.RefrestToken = refreshToken
+	}
+	respondWithJson(w, http.StatusOK, res)
+}
+
+// handleLogout ends the session the request was made with and clears the
+// session cookies, if any.
+func (cfg *apiConfig) handleLogout(w http.ResponseWriter, r *http.Request) {
+	p := principal(r)
+
+	if p.SessionID != uuid.Nil {
+		_, err := cfg.dbQueries.RevokeSession(r.Context(), database.RevokeSessionParams{
+			ID:     p.SessionID,
+			UserID: p.UserID,
+		})
+		if err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "Couldn't revoke session", err)
+			return
+		}
+		cfg.publishSessionRevoked(r.Context(), p.UserID, p.SessionID)
+	}
+
+	cfg.clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type sessionResp struct {
+	Id         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IpAddress  string    `json:"ip_address"`
+	Current    bool      `json:"current"`
+}
+
+func (cfg *apiConfig) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	p := principal(r)
+
+	sessions, err := cfg.dbQueries.ListSessions(r.Context(), p.UserID)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't list sessions", err)
+		return
+	}
+
+	sessionsRes := []sessionResp{}
+	for _, s := range sessions {
+		sessionsRes = append(sessionsRes, sessionResp{
+			Id:         s.ID,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			UserAgent:  s.UserAgent,
+			IpAddress:  s.IpAddress,
+			Current:    s.ID == p.SessionID,
+		})
+	}
+
+	respondWithJson(w, http.StatusOK, sessionsRes)
+}
+
+func (cfg *apiConfig) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "invalid uuid format", err)
+		return
+	}
+
+	n, err := cfg.dbQueries.RevokeSession(r.Context(), database.RevokeSessionParams{
+		ID:     id,
+		UserID: principal(r).UserID,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't revoke session", err)
+		return
+	}
+	// someone else's session looks the same as a missing one
+	if n == 0 {
+		respondWithErr(w, http.StatusNotFound, "Session not found", nil)
+		return
+	}
+	cfg.publishSessionRevoked(r.Context(), principal(r).UserID, id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRevokeOtherSessions logs out every device except the one making the
+// request.
+func (cfg *apiConfig) handleRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	p := principal(r)
+
+	n, err := cfg.dbQueries.RevokeOtherSessions(r.Context(), database.RevokeOtherSessionsParams{
+		UserID: p.UserID,
+		ID:     p.SessionID,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+	cfg.publishAllSessionsRevoked(r.Context(), p.UserID, p.SessionID)
+
+	respondWithJson(w, http.StatusOK, struct {
+		Revoked int64 `json:"revoked"`
+	}{
+		Revoked: n,
+	})
+}
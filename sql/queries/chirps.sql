@@ -12,13 +12,32 @@ RETURNING *;
 
 -- name: GetAllChirps :many
 SELECT * FROM chirps
+WHERE deleted_at IS NULL
 ORDER BY created_at ASC;
 
 
 -- name: GetChirp :one
+SELECT * FROM chirps WHERE id = $1 AND deleted_at IS NULL;
+
+
+-- name: GetChirpIncludingDeleted :one
 SELECT * FROM chirps WHERE id = $1;
 
 
--- name: DeleteChirp :one
-DELETE FROM chirps WHERE id = $1
+-- name: SoftDeleteChirp :one
+UPDATE chirps
+SET deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
 RETURNING *;
+
+
+-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NOT NULL
+RETURNING *;
+
+
+-- name: PurgeDeletedChirps :execrows
+DELETE FROM chirps
+WHERE deleted_at < $1;
@@ -0,0 +1,73 @@
+-- name: EnqueueJob :one
+INSERT INTO jobs (id, created_at, updated_at, kind, payload, status, attempts, max_attempts, run_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    'pending',
+    0,
+    $3,
+    $4
+)
+RETURNING *;
+
+
+-- name: ClaimJob :one
+UPDATE jobs
+SET status = 'running', attempts = attempts + 1, locked_at = NOW(), updated_at = NOW()
+WHERE id = (
+    SELECT id FROM jobs
+    WHERE status = 'pending' AND run_at <= NOW()
+    ORDER BY run_at
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+
+-- name: CompleteJob :exec
+UPDATE jobs
+SET status = 'done', locked_at = NULL, finished_at = NOW(), last_error = NULL, updated_at = NOW()
+WHERE id = $1;
+
+
+-- name: RetryJob :exec
+UPDATE jobs
+SET status = 'pending', locked_at = NULL, run_at = $2, last_error = $3, updated_at = NOW()
+WHERE id = $1;
+
+
+-- name: FailJob :exec
+UPDATE jobs
+SET status = 'failed', locked_at = NULL, finished_at = NOW(), last_error = $2, updated_at = NOW()
+WHERE id = $1;
+
+
+-- name: RequeueStaleJobs :execrows
+UPDATE jobs
+SET
+    status = CASE WHEN attempts >= max_attempts THEN 'failed' ELSE 'pending' END,
+    locked_at = NULL,
+    finished_at = CASE WHEN attempts >= max_attempts THEN NOW() ELSE finished_at END,
+    last_error = CASE WHEN attempts >= max_attempts THEN 'lease ran out on the last attempt' ELSE last_error END,
+    updated_at = NOW()
+WHERE status = 'running' AND locked_at < $1;
+
+
+-- name: DeleteFinishedJobs :execrows
+DELETE FROM jobs
+WHERE status IN ('done', 'failed') AND finished_at < $1;
+
+
+-- name: ListJobs :many
+SELECT * FROM jobs
+ORDER BY created_at DESC
+LIMIT $1;
+
+
+-- name: CountJobsByStatus :many
+SELECT status, COUNT(*) AS count FROM jobs
+GROUP BY status
+ORDER BY status;
@@ -0,0 +1,10 @@
+-- name: CreateFailedLogin :exec
+INSERT INTO login_attempts (id, created_at, email, user_id, ip_address, reason)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+);
@@ -0,0 +1,46 @@
+-- name: CreateNotification :one
+INSERT INTO notifications (id, created_at, user_id, type, actor_id, chirp_id, data)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+
+-- name: ListNotifications :many
+SELECT * FROM notifications
+WHERE
+    user_id = sqlc.arg(user_id)
+    AND (NOT sqlc.arg(unread_only)::bool OR read_at IS NULL)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(row_limit);
+
+
+-- name: CountUnreadNotifications :one
+SELECT COUNT(*) FROM notifications
+WHERE user_id = $1 AND read_at IS NULL;
+
+
+-- name: MarkNotificationsRead :execrows
+UPDATE notifications
+SET read_at = NOW()
+WHERE
+    user_id = sqlc.arg(user_id)
+    AND id = ANY(sqlc.arg(ids)::uuid[])
+    AND read_at IS NULL;
+
+
+-- name: MarkAllNotificationsRead :execrows
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL;
+
+
+-- name: DeleteReadNotifications :execrows
+DELETE FROM notifications
+WHERE read_at < $1;
@@ -0,0 +1,118 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, created_at, updated_at, user_id, name, redirect_uris, secret_hash, scopes)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1;
+
+-- name: ListOAuthClients :many
+SELECT * FROM oauth_clients
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1 AND user_id = $2;
+
+-- name: CreateAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (
+    code_hash, created_at, expires_at, used_at, client_id, user_id, redirect_uri, scopes, code_challenge
+) VALUES (
+    $1,
+    NOW(),
+    $2,
+    NULL,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+);
+
+-- name: UseAuthorizationCode :one
+UPDATE oauth_authorization_codes
+SET used_at = NOW()
+WHERE
+    code_hash = $1
+    AND client_id = $2
+    AND (used_at IS NULL)
+    AND (expires_at > NOW())
+RETURNING *;
+
+-- name: CreateOAuthGrant :one
+INSERT INTO oauth_grants (
+    id, created_at, updated_at, client_id, user_id, scopes, refresh_token_hash, expires_at, revoked_at, last_used_at
+) VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    NULL,
+    NOW()
+)
+RETURNING *;
+
+-- name: RotateOAuthGrant :one
+UPDATE oauth_grants
+SET refresh_token_hash = sqlc.arg(new_refresh_token_hash), last_used_at = NOW(), updated_at = NOW()
+WHERE
+    refresh_token_hash = sqlc.arg(refresh_token_hash)
+    AND client_id = sqlc.arg(client_id)
+    AND (revoked_at IS NULL)
+    AND (expires_at > NOW())
+RETURNING *;
+
+-- name: GetActiveOAuthGrant :one
+SELECT * FROM oauth_grants
+WHERE id = $1 AND (revoked_at IS NULL) AND (expires_at > NOW());
+
+-- name: GetActiveOAuthGrantByRefreshHash :one
+SELECT * FROM oauth_grants
+WHERE refresh_token_hash = $1 AND (revoked_at IS NULL) AND (expires_at > NOW());
+
+-- name: RevokeOAuthGrant :execrows
+UPDATE oauth_grants
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND client_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllOAuthGrants :exec
+UPDATE oauth_grants
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: ListUserOAuthGrants :many
+SELECT
+    oauth_grants.id,
+    oauth_grants.created_at,
+    oauth_grants.client_id,
+    oauth_clients.name AS client_name,
+    oauth_grants.scopes,
+    oauth_grants.expires_at,
+    oauth_grants.last_used_at
+FROM oauth_grants
+JOIN oauth_clients ON oauth_clients.id = oauth_grants.client_id
+WHERE
+    oauth_grants.user_id = $1
+    AND (oauth_grants.revoked_at IS NULL)
+    AND (oauth_grants.expires_at > NOW())
+ORDER BY oauth_grants.last_used_at DESC;
+
+-- name: RevokeUserOAuthGrant :execrows
+UPDATE oauth_grants
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
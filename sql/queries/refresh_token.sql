@@ -1,28 +1,65 @@
 -- name: CreateRefreshToken :one
 INSERT INTO refresh_tokens (
-    token,
+    id,
+    token_hash,
     created_at,
     updated_at,
     expires_at,
     revoked_at,
-    user_id
+    user_id,
+    user_agent,
+    ip_address,
+    last_used_at
 ) VALUES (
+    gen_random_uuid(),
     $1,
     NOW(),
     NOW(),
     NOW() + INTERVAL '60 days',
     NULL,
-    $2
+    $2,
+    $3,
+    $4,
+    NOW()
 )
 RETURNING *;
 
--- name: GetUserFromRefreshToken :one
-SELECT 
-    users.id AS user_id,  
-    users.email AS user_email
-FROM users
-INNER JOIN refresh_tokens on users.id = refresh_tokens.user_id
+-- name: UseRefreshToken :one
+UPDATE refresh_tokens
+SET last_used_at = NOW(), user_agent = $2, ip_address = $3
 WHERE
-    refresh_tokens.token = $1
-    AND (refresh_tokens.expires_at > NOW())
-    AND (refresh_tokens.revoked_at IS NULL);
+    token_hash = $1
+    AND (expires_at > NOW())
+    AND (revoked_at IS NULL)
+RETURNING id, user_id;
+
+-- name: ListSessions :many
+SELECT * FROM refresh_tokens
+WHERE
+    user_id = $1
+    AND (expires_at > NOW())
+    AND (revoked_at IS NULL)
+ORDER BY last_used_at DESC;
+
+-- name: ListRevokedSessionIDs :many
+SELECT id FROM refresh_tokens
+WHERE revoked_at > $1;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeOtherSessions :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllSessions :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: PurgeRefreshTokens :execrows
+DELETE FROM refresh_tokens
+WHERE expires_at < NOW() OR revoked_at < $1;
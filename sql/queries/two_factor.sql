@@ -0,0 +1,36 @@
+-- name: UpsertUserTOTP :exec
+INSERT INTO user_totp (user_id, created_at, updated_at, secret, confirmed_at, last_step)
+VALUES ($1, NOW(), NOW(), $2, NULL, 0)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, updated_at = NOW(), confirmed_at = NULL, last_step = 0;
+
+-- name: GetUserTOTP :one
+SELECT * FROM user_totp
+WHERE user_id = $1;
+
+-- name: ConfirmUserTOTP :exec
+UPDATE user_totp
+SET confirmed_at = NOW(), updated_at = NOW(), last_step = $2
+WHERE user_id = $1;
+
+-- name: AdvanceTOTPStep :execrows
+UPDATE user_totp
+SET last_step = $2, updated_at = NOW()
+WHERE user_id = $1 AND last_step < $2;
+
+-- name: DeleteUserTOTP :exec
+DELETE FROM user_totp
+WHERE user_id = $1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (id, created_at, user_id, code_hash, used_at)
+VALUES (gen_random_uuid(), NOW(), $1, $2, NULL);
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
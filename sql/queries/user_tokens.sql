@@ -0,0 +1,36 @@
+-- name: CreateUserToken :one
+INSERT INTO user_tokens (id, created_at, expires_at, used_at, token_hash, purpose, user_id, email)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    NULL,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: UseUserToken :one
+UPDATE user_tokens
+SET used_at = NOW()
+WHERE
+    token_hash = $1
+    AND purpose = $2
+    AND (expires_at > NOW())
+    AND (used_at IS NULL)
+RETURNING *;
+
+-- name: InvalidateUserTokens :exec
+UPDATE user_tokens
+SET used_at = NOW()
+WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL;
+
+-- name: GetValidUserToken :one
+SELECT * FROM user_tokens
+WHERE
+    token_hash = $1
+    AND purpose = $2
+    AND (expires_at > NOW())
+    AND (used_at IS NULL);
@@ -0,0 +1,117 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (id, created_at, updated_at, user_id, url, event_types, secret, consecutive_failures)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    0
+)
+RETURNING *;
+
+
+-- name: GetWebhook :one
+SELECT * FROM webhooks
+WHERE id = $1;
+
+
+-- name: ListWebhooks :many
+SELECT * FROM webhooks
+WHERE user_id = $1
+ORDER BY created_at;
+
+
+-- name: ListAllWebhooks :many
+SELECT * FROM webhooks
+ORDER BY created_at;
+
+
+-- name: ListActiveWebhooksForEvent :many
+SELECT * FROM webhooks
+WHERE disabled_at IS NULL AND sqlc.arg(event_type)::text = ANY(event_types)
+ORDER BY created_at;
+
+
+-- name: DeleteWebhook :exec
+DELETE FROM webhooks
+WHERE id = $1;
+
+
+-- name: EnableWebhook :one
+UPDATE webhooks
+SET disabled_at = NULL, disabled_reason = NULL, consecutive_failures = 0, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+
+-- name: DisableWebhook :exec
+UPDATE webhooks
+SET disabled_at = NOW(), disabled_reason = $2, updated_at = NOW()
+WHERE id = $1 AND disabled_at IS NULL;
+
+
+-- name: RecordWebhookSuccess :exec
+UPDATE webhooks
+SET consecutive_failures = 0, last_success_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+
+-- name: RecordWebhookFailure :one
+UPDATE webhooks
+SET consecutive_failures = consecutive_failures + 1, updated_at = NOW()
+WHERE id = $1
+RETURNING consecutive_failures;
+
+
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (id, created_at, updated_at, webhook_id, event_type, payload, status, attempts)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    'pending',
+    0
+)
+RETURNING *;
+
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = $1;
+
+
+-- name: RecordWebhookAttempt :exec
+UPDATE webhook_deliveries
+SET
+    status = $2,
+    attempts = attempts + 1,
+    last_attempt_at = NOW(),
+    response_status = $3,
+    response_body = $4,
+    last_error = $5,
+    updated_at = NOW()
+WHERE id = $1;
+
+
+-- name: FailWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET status = 'failed', last_error = $2, updated_at = NOW()
+WHERE id = $1;
+
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE webhook_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+
+-- name: DeleteOldWebhookDeliveries :execrows
+DELETE FROM webhook_deliveries
+WHERE created_at < $1;
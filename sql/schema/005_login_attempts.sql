@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE login_attempts (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    email TEXT NOT NULL,
+    user_id UUID,
+    ip_address TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    CONSTRAINT user_fk FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX login_attempts_email_idx ON login_attempts (email, created_at);
+
+-- +goose Down
+DROP TABLE login_attempts;
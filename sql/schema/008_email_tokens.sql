@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP;
+
+CREATE TABLE user_tokens (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    token_hash TEXT NOT NULL UNIQUE,
+    -- 'verify_email' or 'reset_password'
+    purpose TEXT NOT NULL,
+    user_id UUID NOT NULL,
+    -- the address a verification token was sent to, so changing the email
+    -- afterwards doesn't let the old link verify the new one
+    email TEXT NOT NULL,
+    CONSTRAINT user_fk FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE user_tokens;
+ALTER TABLE users DROP COLUMN email_verified_at;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- set when the author deletes a chirp; the row is purged after the
+-- retention period, see CHIRP_RETENTION
+ALTER TABLE chirps ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX chirps_deleted_at_idx ON chirps (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+-- without the column these would show up again
+DELETE FROM chirps WHERE deleted_at IS NOT NULL;
+DROP INDEX chirps_deleted_at_idx;
+ALTER TABLE chirps DROP COLUMN deleted_at;
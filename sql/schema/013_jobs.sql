@@ -0,0 +1,23 @@
+-- +goose Up
+-- one-off background work; workers claim rows with SKIP LOCKED so any number
+-- of instances can share the queue
+CREATE TABLE jobs (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    kind TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    -- pending, running, done or failed
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    max_attempts INTEGER NOT NULL,
+    run_at TIMESTAMP NOT NULL,
+    locked_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    last_error TEXT
+);
+
+CREATE INDEX jobs_pending_idx ON jobs (run_at) WHERE status = 'pending';
+
+-- +goose Down
+DROP TABLE jobs;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE notifications (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    -- who gets it
+    user_id UUID NOT NULL,
+    -- e.g. like, reply, mention, follow
+    type TEXT NOT NULL,
+    -- who caused it, when that's a user
+    actor_id UUID,
+    chirp_id UUID,
+    -- anything else the client needs to render it
+    data JSONB NOT NULL,
+    read_at TIMESTAMP,
+    CONSTRAINT user_fk FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT actor_fk FOREIGN KEY(actor_id) REFERENCES users(id) ON DELETE SET NULL,
+    CONSTRAINT chirp_fk FOREIGN KEY(chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_user_idx ON notifications (user_id, created_at DESC);
+CREATE INDEX notifications_unread_idx ON notifications (user_id) WHERE read_at IS NULL;
+
+-- +goose Down
+DROP TABLE notifications;
@@ -0,0 +1,42 @@
+-- +goose Up
+CREATE TABLE webhooks (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    url TEXT NOT NULL,
+    event_types TEXT[] NOT NULL,
+    -- the HMAC key for the signature header; stored as is, we need it to sign
+    secret TEXT NOT NULL,
+    -- failed attempts since the last successful one
+    consecutive_failures INTEGER NOT NULL,
+    last_success_at TIMESTAMP,
+    -- set when too many attempts in a row failed, or by hand
+    disabled_at TIMESTAMP,
+    disabled_reason TEXT,
+    CONSTRAINT user_fk FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE webhook_deliveries (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    webhook_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    -- pending, succeeded or failed
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    last_attempt_at TIMESTAMP,
+    -- what the receiver answered to the last attempt, if it answered
+    response_status INTEGER,
+    response_body TEXT,
+    last_error TEXT,
+    CONSTRAINT webhook_fk FOREIGN KEY(webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
@@ -0,0 +1,8 @@
+// Package schema embeds the goose migrations in this directory so the
+// server binary can bring its own database up to date.
+package schema
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/sharath070/Chirpy/internal/stream"
+)
+
+// streamPathPrefix is where the long-lived connections live. They are exempt
+// from the request timeout, see middlewareTimeout.
+const streamPathPrefix = "/api/stream/"
+
+const (
+	// a comment line this often keeps proxies from closing an idle stream
+	streamHeartbeat = 15 * time.Second
+	// how long EventSource waits before reconnecting
+	streamRetry = 3 * time.Second
+	// a client that can't take a write for this long is gone
+	streamWriteTimeout = 10 * time.Second
+)
+
+// hashtags returns the distinct #tags in body, lowercased and without the #.
+func hashtags(body string) []string {
+	var tags []string
+	for _, word := range strings.Fields(body) {
+		if !strings.HasPrefix(word, "#") {
+			continue
+		}
+		tag := normalizeHashtag(word)
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// normalizeHashtag turns "#Go!" into "go": no leading #, lowercase, cut at
+// the first character that can't be part of a tag.
+func normalizeHashtag(s string) string {
+	s = strings.TrimPrefix(s, "#")
+	if i := strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}); i >= 0 {
+		s = s[:i]
+	}
+	return strings.ToLower(s)
+}
+
+// handleChirpStream is a Server-Sent Events stream of chirp events (created,
+// deleted, restored), optionally only those by author_id and/or tagged
+// hashtag. Reconnecting clients send Last-Event-ID and get the events they
+// missed; when those are no longer available they get a "reset" event and
+// should reload instead.
+func (cfg *apiConfig) handleChirpStream(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var author uuid.UUID
+	if s := q.Get("author_id"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			respondWithErr(w, http.StatusBadRequest, "invalid author_id", err)
+			return
+		}
+		author = id
+	}
+	tag := normalizeHashtag(q.Get("hashtag"))
+
+	var lastID uint64
+	if s := r.Header.Get("Last-Event-ID"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			respondWithErr(w, http.StatusBadRequest, "invalid Last-Event-ID", err)
+			return
+		}
+		lastID = id
+	}
+
+	match := func(e stream.Event) bool {
+		if author != uuid.Nil && !e.HasTopic("author:"+author.String()) {
+			return false
+		}
+		return tag == "" || e.HasTopic("hashtag:"+tag)
+	}
+	sub, missed, complete := cfg.chirpHub.Subscribe(lastID, match)
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// nginx buffers responses by default, which would hold events back
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(format string, args ...any) bool {
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	sendEvent := func(e stream.Event) bool {
+		// the JSON is on one line, so it fits in a single data field
+		return send("id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+	}
+
+	if !send("retry: %d\n\n", streamRetry.Milliseconds()) {
+		return
+	}
+	if !complete && !send("event: reset\ndata: {}\n\n") {
+		return
+	}
+	for _, e := range missed {
+		if !sendEvent(e) {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				// fell too far behind; the client reconnects with
+				// Last-Event-ID and catches up from the backlog
+				return
+			}
+			if !sendEvent(e) {
+				return
+			}
+		case <-heartbeat.C:
+			if !send(": ping\n\n") {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharath070/Chirpy/internal/auth"
+	"github.com/sharath070/Chirpy/internal/database"
+	"github.com/sharath070/Chirpy/internal/validate"
+)
+
+type createTokenParams struct {
+	Name   string   `json:"name" validate:"required,max=100"`
+	Scopes []string `json:"scopes" validate:"required,min=1"`
+	// 0 means the token never expires
+	ExpiresInDays int `json:"expires_in_days" validate:"min=0,max=365"`
+}
+
+type tokenResp struct {
+	Id         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	TokenHint  string     `json:"token_hint"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	// only set in the response to creating the token
+	Token string `json:"token,omitempty"`
+}
+
+func newTokenResp(t database.PersonalAccessToken) tokenResp {
+	return tokenResp{
+		Id:         t.ID,
+		Name:       t.Name,
+		Scopes:     t.Scopes,
+		TokenHint:  t.TokenHint,
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  nullTimePtr(t.ExpiresAt),
+		LastUsedAt: nullTimePtr(t.LastUsedAt),
+	}
+}
+
+func (cfg *apiConfig) handleCreateToken(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeJSON[createTokenParams](w, r)
+	if err != nil {
+		respondWithDecodeErr(w, err)
+		return
+	}
+
+	scopes, err := auth.CheckGrantableScopes(params.Scopes)
+	if err != nil {
+		respondWithDecodeErr(w, validate.Errors{{Field: "scopes", Message: err.Error()}})
+		return
+	}
+
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't create token", err)
+		return
+	}
+
+	var expiresAt sql.NullTime
+	if params.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, params.ExpiresInDays), Valid: true}
+	}
+
+	pat, err := cfg.dbQueries.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    principal(r).UserID,
+		Name:      params.Name,
+		TokenHash: auth.HashOpaqueToken(token),
+		TokenHint: token[len(token)-4:],
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't create token", err)
+		return
+	}
+
+	res := newTokenResp(pat)
+	res.Token = token
+	respondWithJson(w, http.StatusCreated, res)
+}
+
+func (cfg *apiConfig) handleListTokens(w http.ResponseWriter, r *http.Request) {
+	pats, err := cfg.dbQueries.ListPersonalAccessTokens(r.Context(), principal(r).UserID)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't list tokens", err)
+		return
+	}
+
+	tokensRes := []tokenResp{}
+	for _, t := range pats {
+		tokensRes = append(tokensRes, newTokenResp(t))
+	}
+
+	respondWithJson(w, http.StatusOK, tokensRes)
+}
+
+func (cfg *apiConfig) handleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "invalid uuid format", err)
+		return
+	}
+
+	n, err := cfg.dbQueries.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     id,
+		UserID: principal(r).UserID,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't revoke token", err)
+		return
+	}
+	if n == 0 {
+		respondWithErr(w, http.StatusNotFound, "Token not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticatePAT resolves a personal access token to its principal. The
+// scopes are always non-nil, so a token created with no matching scope can't
+// fall through to "unrestricted".
+func (cfg *apiConfig) authenticatePAT(ctx context.Context, token string) (auth.Principal, error) {
+	pat, err := cfg.dbQueries.UsePersonalAccessToken(ctx, auth.HashOpaqueToken(token))
+	if err != nil {
+		return auth.Principal{}, err
+	}
+
+	return auth.Principal{
+		UserID:    pat.UserID,
+		Scopes:    append([]string{}, pat.Scopes...),
+		TokenID:   pat.ID.String(),
+		ExpiresAt: pat.ExpiresAt.Time,
+	}, nil
+}
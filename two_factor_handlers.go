@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharath070/Chirpy/internal/auth"
+	"github.com/sharath070/Chirpy/internal/database"
+)
+
+const (
+	recoveryCodeCount = 10
+	mfaChallengeTTL   = 5 * time.Minute
+	totpIssuer        = "Chirpy"
+
+	// user_tokens purpose for an MFA challenge's jti
+	tokenPurposeMFAChallenge = "mfa_challenge"
+)
+
+type twoFactorEnrollResp struct {
+	Secret        string   `json:"secret"`
+	OtpauthURI    string   `json:"otpauth_uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// handleEnrollTwoFactor starts (or restarts) enrollment. Two-factor isn't
+// enforced until the user proves their authenticator works via
+// handleConfirmTwoFactor.
+func (cfg *apiConfig) handleEnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userId := principal(r).UserID
+
+	enabled, err := cfg.twoFactorEnabled(r.Context(), userId)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't check two-factor status", err)
+		return
+	}
+	if enabled {
+		respondWithErr(w, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userId)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't find user", err)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't generate secret", err)
+		return
+	}
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't generate recovery codes", err)
+		return
+	}
+
+	// the secret and its recovery codes are saved together or not at all
+	err = cfg.tx.InTx(r.Context(), func(q *database.Queries) error {
+		err := q.UpsertUserTOTP(r.Context(), database.UpsertUserTOTPParams{
+			UserID: userId,
+			Secret: auth.EncodeTOTPSecret(secret),
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := q.DeleteRecoveryCodes(r.Context(), userId); err != nil {
+			return err
+		}
+		for _, c := range codes {
+			err := q.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+				UserID:   userId,
+				CodeHash: auth.HashRecoveryCode(c),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't save two-factor settings", err)
+		return
+	}
+
+	respondWithJson(w, http.StatusCreated, twoFactorEnrollResp{
+		Secret:        auth.EncodeTOTPSecret(secret),
+		OtpauthURI:    auth.DefaultTOTPConfig.URI(totpIssuer, user.Email, secret),
+		RecoveryCodes: codes,
+	})
+}
+
+type totpCodeParams struct {
+	Code string `json:"code" validate:"required"`
+}
+
+func (cfg *apiConfig) handleConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userId := principal(r).UserID
+
+	params, err := decodeJSON[totpCodeParams](w, r)
+	if err != nil {
+		respondWithDecodeErr(w, err)
+		return
+	}
+
+	totp, err := cfg.dbQueries.GetUserTOTP(r.Context(), userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithErr(w, http.StatusNotFound, "Two-factor enrollment not started", err)
+		return
+	}
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't load two-factor settings", err)
+		return
+	}
+	if totp.ConfirmedAt.Valid {
+		respondWithErr(w, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	limitKey := "mfa:" + userId.String()
+	if wait := cfg.loginLimiter.Allow(limitKey); wait > 0 {
+		setRetryAfter(w, wait)
+		respondWithErr(w, http.StatusTooManyRequests, "Too many failed attempts, try again later", nil)
+		return
+	}
+	step, ok := verifyTOTP(totp, params.Code)
+	if !ok {
+		setRetryAfter(w, cfg.loginLimiter.Wait(limitKey))
+		respondWithErr(w, http.StatusUnauthorized, "Invalid code", nil)
+		return
+	}
+	cfg.loginLimiter.Reset(limitKey)
+
+	err = cfg.dbQueries.ConfirmUserTOTP(r.Context(), database.ConfirmUserTOTPParams{
+		UserID:   userId,
+		LastStep: step,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't enable two-factor", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDisableTwoFactor needs a current code so a stolen access token alone
+// can't switch it off.
+func (cfg *apiConfig) handleDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userId := principal(r).UserID
+
+	params, err := decodeJSON[totpCodeParams](w, r)
+	if err != nil {
+		respondWithDecodeErr(w, err)
+		return
+	}
+
+	limitKey := "mfa:" + userId.String()
+	if wait := cfg.loginLimiter.Allow(limitKey); wait > 0 {
+		setRetryAfter(w, wait)
+		respondWithErr(w, http.StatusTooManyRequests, "Too many failed attempts, try again later", nil)
+		return
+	}
+	ok, err := cfg.checkSecondFactor(r.Context(), userId, params.Code, "")
+	if err != nil {
+		cfg.loginLimiter.Release(limitKey)
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't check code", err)
+		return
+	}
+	if !ok {
+		setRetryAfter(w, cfg.loginLimiter.Wait(limitKey))
+		respondWithErr(w, http.StatusUnauthorized, "Invalid code", nil)
+		return
+	}
+	cfg.loginLimiter.Reset(limitKey)
+
+	err = cfg.tx.InTx(r.Context(), func(q *database.Queries) error {
+		if err := q.DeleteUserTOTP(r.Context(), userId); err != nil {
+			return err
+		}
+		return q.DeleteRecoveryCodes(r.Context(), userId)
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't disable two-factor", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type mfaLoginParams struct {
+	MFAToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// handleLoginTwoFactor is the second step of a login for accounts with
+// two-factor enabled: it trades the challenge token from handleLoginUser plus
+// a TOTP or recovery code for the real access/refresh pair. A challenge is
+// used up by the login it completes, and wrong codes count against the
+// account in loginLimiter whichever challenge they came with.
+func (cfg *apiConfig) handleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeJSON[mfaLoginParams](w, r)
+	if err != nil {
+		respondWithDecodeErr(w, err)
+		return
+	}
+	if (params.Code == "") == (params.RecoveryCode == "") {
+		respondWithErr(w, http.StatusBadRequest, "Provide exactly one of code or recovery_code", nil)
+		return
+	}
+
+	challenge, err := cfg.keyring.ParseMFAChallenge(params.MFAToken)
+	if err != nil {
+		respondWithErr(w, http.StatusUnauthorized, "Invalid or expired challenge", err)
+		return
+	}
+	userId := challenge.UserID
+	challengeHash := auth.HashOpaqueToken(challenge.TokenID)
+
+	// used, or replaced by a newer login
+	_, err = cfg.dbQueries.GetValidUserToken(r.Context(), database.GetValidUserTokenParams{
+		TokenHash: challengeHash,
+		Purpose:   tokenPurposeMFAChallenge,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithErr(w, http.StatusUnauthorized, "Invalid or expired challenge", err)
+		return
+	}
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't check challenge", err)
+		return
+	}
+
+	limitKey := "mfa:" + userId.String()
+	if wait := cfg.loginLimiter.Allow(limitKey); wait > 0 {
+		setRetryAfter(w, wait)
+		respondWithErr(w, http.StatusTooManyRequests, "Too many failed attempts, try again later", nil)
+		return
+	}
+
+	ok, err := cfg.checkSecondFactor(r.Context(), userId, params.Code, params.RecoveryCode)
+	if err != nil {
+		cfg.loginLimiter.Release(limitKey)
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't check code", err)
+		return
+	}
+	if !ok {
+		user, _ := cfg.dbQueries.GetUserByID(r.Context(), userId)
+		cfg.recordFailedLogin(r.Context(), user.Email, uuid.NullUUID{UUID: userId, Valid: true}, clientIP(r), "bad_second_factor")
+		setRetryAfter(w, cfg.loginLimiter.Wait(limitKey))
+		respondWithErr(w, http.StatusUnauthorized, "Invalid code", nil)
+		return
+	}
+	cfg.loginLimiter.Reset(limitKey)
+
+	// a concurrent request with the same challenge may have got here first
+	_, err = cfg.dbQueries.UseUserToken(r.Context(), database.UseUserTokenParams{
+		TokenHash: challengeHash,
+		Purpose:   tokenPurposeMFAChallenge,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithErr(w, http.StatusUnauthorized, "Invalid or expired challenge", err)
+		return
+	}
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't check challenge", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userId)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't find user", err)
+		return
+	}
+
+	cfg.respondWithSession(w, r, user)
+}
+
+func (cfg *apiConfig) twoFactorEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	totp, err := cfg.dbQueries.GetUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return totp.ConfirmedAt.Valid, nil
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code.
+// Both are single use: the TOTP step is advanced atomically and the recovery
+// code is marked used, so two concurrent requests can't both succeed.
+func (cfg *apiConfig) checkSecondFactor(ctx context.Context, userID uuid.UUID, code, recoveryCode string) (bool, error) {
+	totp, err := cfg.dbQueries.GetUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !totp.ConfirmedAt.Valid) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if recoveryCode != "" {
+		n, err := cfg.dbQueries.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashRecoveryCode(recoveryCode),
+		})
+		return n == 1, err
+	}
+
+	step, ok := verifyTOTP(totp, code)
+	if !ok {
+		return false, nil
+	}
+	n, err := cfg.dbQueries.AdvanceTOTPStep(ctx, database.AdvanceTOTPStepParams{
+		UserID:   userID,
+		LastStep: step,
+	})
+	return n == 1, err
+}
+
+func verifyTOTP(totp database.UserTotp, code string) (int64, bool) {
+	secret, err := auth.DecodeTOTPSecret(totp.Secret)
+	if err != nil {
+		return 0, false
+	}
+	return auth.DefaultTOTPConfig.Verify(secret, code, time.Now(), totp.LastStep)
+}
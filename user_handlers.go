@@ -2,39 +2,47 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"database/sql"
+	"errors"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/sharath070/Chirpy/internal/auth"
 	"github.com/sharath070/Chirpy/internal/database"
+	"github.com/sharath070/Chirpy/internal/validate"
 )
 
 type userParams struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
 }
 
 type userResp struct {
-	Id           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	Token        string    `json:"token,omitempty"`
-	RefrestToken string    `json:"refrest_token"`
+	Id            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Token         string    `json:"token,omitempty"`
+	RefrestToken  string    `json:"refrest_token"`
 }
 
 func (cfg *apiConfig) handleCreateUser(w http.ResponseWriter, r *http.Request) {
-	var params userParams
-
-	err := json.NewDecoder(r.Body).Decode(&params)
+	params, err := decodeJSON[userParams](w, r)
 	if err != nil {
-		respondWithErr(w, http.StatusInternalServerError, "Error decoding parameters", err)
+		respondWithDecodeErr(w, err)
+		return
+	}
+
+	if err := cfg.passwordPolicy.Check(params.Password, params.Email); err != nil {
+		respondWithDecodeErr(w, validate.Errors{{Field: "password", Message: err.Error()}})
 		return
 	}
 
-	hash, err := auth.HashPassword(params.Password)
+	hash, err := cfg.passwordHasher.Hash(params.Password)
 	if err != nil {
 		respondWithErr(w, http.StatusInternalServerError, "Failed to generate the hash password", err)
 		return
@@ -48,87 +56,335 @@ func (cfg *apiConfig) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 		respondWithErr(w, http.StatusBadRequest, "Error creating user", err)
 		return
 	}
+	cfg.publishUser(r.Context(), eventUserCreated, user)
+
+	// the account works without it; they can ask for another link later
+	// through POST /api/users/verify/resend
+	if err := cfg.sendVerificationEmail(r.Context(), user); err != nil {
+		log.Printf("send verification email to %s: %v", user.Email, err)
+	}
 
 	userRes := userResp{
-		Id:        user.ID,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-		Email:     user.Email,
+		Id:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 	}
 	respondWithJson(w, http.StatusCreated, userRes)
 }
 
-func (cfg *apiConfig) handleLoginUser(w http.ResponseWriter, r *http.Request) {
-	var params userParams
+type updateUserParams struct {
+	Email           string `json:"email" validate:"required,email"`
+	Password        string `json:"password" validate:"required"`
+	CurrentPassword string `json:"current_password" validate:"required"`
+	// required when two-factor is enabled
+	Code string `json:"code"`
+}
+
+// handleUpdateUser changes the caller's email and password. It wants the
+// current password, and a TOTP code when two-factor is on, so that a stolen
+// access token alone can't take the account over. A new password logs out
+// every other session and revokes the caller's tokens and app grants.
+func (cfg *apiConfig) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	p := principal(r)
+	userId := p.UserID
 
-	err := json.NewDecoder(r.Body).Decode(&params)
+	params, err := decodeJSON[updateUserParams](w, r)
 	if err != nil {
-		respondWithErr(w, http.StatusInternalServerError, "Error decoding parameters", err)
+		respondWithDecodeErr(w, err)
 		return
 	}
 
-	user, err := cfg.dbQueries.GetUserByEmail(context.Background(), params.Email)
+	current, err := cfg.dbQueries.GetUserByID(r.Context(), userId)
 	if err != nil {
-		respondWithErr(w, http.StatusBadRequest, "Incorrect email or password", err)
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't look up user", err)
+		return
+	}
+	if current.HashedPassword == auth.UnusablePasswordHash {
+		respondWithErr(w, http.StatusBadRequest, "Account has no password yet, set one with a password reset", nil)
 		return
 	}
 
-	err = auth.CheckPasswordHash(user.HashedPassword, params.Password)
-	if err != nil {
-		respondWithErr(w, http.StatusUnauthorized, "Incorrect email or password", err)
+	limitKey := "reauth:" + userId.String()
+	if wait := cfg.loginLimiter.Allow(limitKey); wait > 0 {
+		setRetryAfter(w, wait)
+		respondWithErr(w, http.StatusTooManyRequests, "Too many failed attempts, try again later", nil)
+		return
+	}
+	if _, err := cfg.passwordHasher.Check(current.HashedPassword, params.CurrentPassword); err != nil {
+		setRetryAfter(w, cfg.loginLimiter.Wait(limitKey))
+		respondWithErr(w, http.StatusUnauthorized, "Incorrect current password", err)
 		return
 	}
 
-	token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+	twoFactor, err := cfg.twoFactorEnabled(r.Context(), userId)
 	if err != nil {
-		respondWithErr(w, http.StatusBadRequest, "error creating jwt token", err)
+		cfg.loginLimiter.Release(limitKey)
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't check two-factor status", err)
 		return
 	}
+	if twoFactor {
+		ok, err := cfg.checkSecondFactor(r.Context(), userId, params.Code, "")
+		if err != nil {
+			cfg.loginLimiter.Release(limitKey)
+			respondWithErr(w, http.StatusInternalServerError, "Couldn't check code", err)
+			return
+		}
+		if !ok {
+			setRetryAfter(w, cfg.loginLimiter.Wait(limitKey))
+			respondWithErr(w, http.StatusUnauthorized, "Invalid code", nil)
+			return
+		}
+	}
+	cfg.loginLimiter.Reset(limitKey)
 
-	refreshToken, err := auth.MakeRefreshToken()
+	if err := cfg.passwordPolicy.Check(params.Password, params.Email); err != nil {
+		respondWithDecodeErr(w, validate.Errors{{Field: "password", Message: err.Error()}})
+		return
+	}
+
+	hash, err := cfg.passwordHasher.Hash(params.Password)
 	if err != nil {
-		respondWithErr(w, http.StatusBadRequest, "error creating refresh token", err)
+		respondWithErr(w, http.StatusInternalServerError, "Failed to generate the hash password", err)
 		return
 	}
+	passwordChanged := params.Password != params.CurrentPassword
+
+	// read and write together, so a concurrent change can't slip in between
+	// and hide that the email changed
+	var oldUser, user database.User
+	err = cfg.tx.InTx(r.Context(), func(q *database.Queries) error {
+		var err error
+		oldUser, err = q.GetUserByID(r.Context(), userId)
+		if err != nil {
+			return err
+		}
+
+		user, err = q.UpdateUser(r.Context(), database.UpdateUserParams{
+			ID:             userId,
+			Email:          params.Email,
+			HashedPassword: hash,
+		})
+		if err != nil {
+			return err
+		}
 
-	refresh, err := cfg.dbQueries.CreateRefreshToken(context.Background(), database.CreateRefreshTokenParams{
-		Token:  refreshToken,
-		UserID: user.ID,
+		if !passwordChanged {
+			return nil
+		}
+		// whoever knew the old password may still be logged in elsewhere,
+		// or have made a token or authorized an app to act for them
+		_, err = q.RevokeOtherSessions(r.Context(), database.RevokeOtherSessionsParams{
+			UserID: userId,
+			ID:     p.SessionID,
+		})
+		if err != nil {
+			return err
+		}
+		return q.RevokeIssuedTokens(r.Context(), userId)
 	})
+	if database.IsUniqueViolation(err) {
+		respondWithErr(w, http.StatusBadRequest, "Email is already in use", err)
+		return
+	}
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't update user", err)
+		return
+	}
+	cfg.publishUser(r.Context(), eventUserUpdated, user)
+	if passwordChanged {
+		cfg.publishAllSessionsRevoked(r.Context(), userId, p.SessionID)
+	}
+
+	if user.Email != oldUser.Email {
+		if err := cfg.sendVerificationEmail(r.Context(), user); err != nil {
+			log.Printf("send verification email to %s: %v", user.Email, err)
+		}
+	}
+
+	userRes := userResp{
+		Id:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+	}
+	respondWithJson(w, http.StatusOK, userRes)
+}
+
+func (cfg *apiConfig) handleLoginUser(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeJSON[userParams](w, r)
+	if err != nil {
+		respondWithDecodeErr(w, err)
+		return
+	}
+
+	ip := clientIP(r)
+	acctKey, ipKey := "acct:"+strings.ToLower(params.Email), "ip:"+ip
+
+	if wait := cfg.loginLimiter.Allow(acctKey, ipKey); wait > 0 {
+		// only counted: a row each would turn a credential stuffing flood
+		// into as many database writes
+		cfg.throttledLogins.Add(1)
+		setRetryAfter(w, wait)
+		respondWithErr(w, http.StatusTooManyRequests, "Too many failed login attempts, try again later", nil)
+		return
+	}
 
-	userResponse := userResp{
-		Id:           user.ID,
-		CreatedAt:    user.CreatedAt,
-		UpdatedAt:    user.UpdatedAt,
-		Email:        user.Email,
-		Token:        token,
-		RefrestToken: refresh.Token,
+	user, err := cfg.dbQueries.GetUserByEmail(r.Context(), params.Email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			// not the caller's fault; don't hold it against them
+			cfg.loginLimiter.Release(acctKey, ipKey)
+			respondWithErr(w, http.StatusInternalServerError, "Couldn't look up user", err)
+			return
+		}
+
+		// spend the same time a real comparison would so response timing
+		// doesn't tell anyone which emails have accounts
+		cfg.passwordHasher.Check(cfg.dummyPasswordHash, params.Password)
+
+		cfg.recordFailedLogin(r.Context(), params.Email, uuid.NullUUID{}, ip, "unknown_email")
+		setRetryAfter(w, cfg.loginLimiter.Wait(acctKey, ipKey))
+		respondWithErr(w, http.StatusUnauthorized, "Incorrect email or password", err)
+		return
+	}
+
+	needsRehash, err := cfg.passwordHasher.Check(user.HashedPassword, params.Password)
+	if errors.Is(err, auth.ErrUnknownHashFormat) {
+		// accounts without a password (UnusablePasswordHash) fail without
+		// hashing anything; don't let that set them apart either
+		cfg.passwordHasher.Check(cfg.dummyPasswordHash, params.Password)
+	}
+	if err != nil {
+		cfg.recordFailedLogin(r.Context(), params.Email, uuid.NullUUID{UUID: user.ID, Valid: true}, ip, "bad_password")
+		setRetryAfter(w, cfg.loginLimiter.Wait(acctKey, ipKey))
+		respondWithErr(w, http.StatusUnauthorized, "Incorrect email or password", err)
+		return
 	}
-	respondWithJson(w, http.StatusOK, userResponse)
+	cfg.loginLimiter.Release(ipKey)
+	cfg.loginLimiter.Reset(acctKey)
+
+	// upgrade the stored hash to the current algorithm/cost while we still
+	// have the plaintext; a failure here shouldn't block the login
+	if needsRehash {
+		cfg.rehashPassword(r.Context(), user.ID, params.Password)
+	}
+
+	cfg.completeLogin(w, r, user)
+}
+
+// completeLogin runs once the user has proven who they are, by password or
+// through an identity provider: it asks for the second factor if one is set
+// up, otherwise it starts a session.
+func (cfg *apiConfig) completeLogin(w http.ResponseWriter, r *http.Request, user database.User) {
+	twoFactor, err := cfg.twoFactorEnabled(r.Context(), user.ID)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't check two-factor status", err)
+		return
+	}
+	if twoFactor {
+		challenge, id, err := cfg.keyring.MakeMFAChallenge(user.ID, mfaChallengeTTL)
+		if err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "error creating mfa challenge", err)
+			return
+		}
+		// the jti is stored so the challenge works once, and only the latest
+		if err := cfg.storeUserToken(r.Context(), user, tokenPurposeMFAChallenge, id, mfaChallengeTTL); err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "error creating mfa challenge", err)
+			return
+		}
+
+		respondWithJson(w, http.StatusOK, struct {
+			MFARequired bool   `json:"mfa_required"`
+			MFAToken    string `json:"mfa_token"`
+		}{
+			MFARequired: true,
+			MFAToken:    challenge,
+		})
+		return
+	}
+
+	cfg.respondWithSession(w, r, user)
 }
 
 func (cfg *apiConfig) handleRefresh(w http.ResponseWriter, r *http.Request) {
 	authToken, err := auth.GetBearerToken(r.Header)
+	fromCookie := false
+	if err != nil && cfg.cookieSessions {
+		if c, cerr := r.Cookie(refreshCookieName); cerr == nil {
+			if !checkCSRF(r) {
+				respondWithErr(w, http.StatusForbidden, "missing or invalid CSRF token", nil)
+				return
+			}
+			authToken, fromCookie, err = c.Value, true, nil
+		}
+	}
 	if err != nil {
 		respondWithErr(w, http.StatusUnauthorized, "malformed header", err)
 		return
 	}
 
-	refreshToken, err := cfg.dbQueries.GetUserFromRefreshToken(context.Background(), authToken)
+	session, err := cfg.dbQueries.UseRefreshToken(r.Context(), database.UseRefreshTokenParams{
+		TokenHash: auth.HashRefreshToken(authToken),
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r),
+	})
 	if err != nil {
 		respondWithErr(w, http.StatusUnauthorized, "refresh token not found", err)
 		return
 	}
 
-	token, err := auth.MakeJWT(refreshToken.UserID, cfg.jwtSecret, time.Hour)
+	token, err := cfg.keyring.MakeAccessToken(auth.Principal{
+		UserID:    session.UserID,
+		SessionID: session.ID,
+	}, accessTokenTTL)
 	if err != nil {
 		respondWithErr(w, http.StatusUnauthorized, "error creating jwt token", err)
 		return
 	}
 
+	if fromCookie {
+		cfg.setAccessCookie(w, token)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	respondWithJson(w, http.StatusOK, struct {
 		Token string `json:"token"`
 	}{
 		Token: token,
 	})
 }
+
+func (cfg *apiConfig) rehashPassword(ctx context.Context, userID uuid.UUID, password string) {
+	hash, err := cfg.passwordHasher.Hash(password)
+	if err != nil {
+		log.Printf("rehash password for user %s: %v", userID, err)
+		return
+	}
+
+	err = cfg.dbQueries.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		ID:             userID,
+		HashedPassword: hash,
+	})
+	if err != nil {
+		log.Printf("rehash password for user %s: %v", userID, err)
+	}
+}
+
+// recordFailedLogin writes the audit row for a rejected login. It never fails
+// the request; losing an audit row is better than locking everyone out when
+// the table is unavailable.
+func (cfg *apiConfig) recordFailedLogin(ctx context.Context, email string, userID uuid.NullUUID, ip, reason string) {
+	err := cfg.dbQueries.CreateFailedLogin(ctx, database.CreateFailedLoginParams{
+		Email:     email,
+		UserID:    userID,
+		IpAddress: ip,
+		Reason:    reason,
+	})
+	if err != nil {
+		log.Printf("record failed login for %s: %v", email, err)
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharath070/Chirpy/internal/auth"
+	"github.com/sharath070/Chirpy/internal/database"
+	"github.com/sharath070/Chirpy/internal/events"
+	"github.com/sharath070/Chirpy/internal/webhook"
+)
+
+// Job kinds on cfg.jobQueue.
+const (
+	jobWebhookFanout  = "webhook.fanout"
+	jobWebhookDeliver = "webhook.deliver"
+)
+
+// webhookEvents are the domain events webhooks can subscribe to.
+var webhookEvents = []string{eventChirpCreated, eventChirpDeleted, eventChirpRestored}
+
+const (
+	minWebhookSecret         = 16
+	defaultWebhookDeliveries = 50
+	maxWebhookDeliveries     = 200
+)
+
+type createWebhookParams struct {
+	URL        string   `json:"url" validate:"required"`
+	EventTypes []string `json:"event_types" validate:"required,min=1"`
+	// optional, one is generated when empty
+	Secret string `json:"secret" validate:"max=200"`
+}
+
+type webhookResp struct {
+	Id                  uuid.UUID  `json:"id"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	UserId              uuid.UUID  `json:"user_id"`
+	Url                 string     `json:"url"`
+	EventTypes          []string   `json:"event_types"`
+	Active              bool       `json:"active"`
+	ConsecutiveFailures int32      `json:"consecutive_failures"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason      string     `json:"disabled_reason,omitempty"`
+	// only in the answer to POST /api/webhooks
+	Secret string `json:"secret,omitempty"`
+}
+
+func newWebhookResp(h database.Webhook) webhookResp {
+	return webhookResp{
+		Id:                  h.ID,
+		CreatedAt:           h.CreatedAt,
+		UpdatedAt:           h.UpdatedAt,
+		UserId:              h.UserID,
+		Url:                 h.Url,
+		EventTypes:          h.EventTypes,
+		Active:              !h.DisabledAt.Valid,
+		ConsecutiveFailures: h.ConsecutiveFailures,
+		LastSuccessAt:       nullTimePtr(h.LastSuccessAt),
+		DisabledAt:          nullTimePtr(h.DisabledAt),
+		DisabledReason:      h.DisabledReason.String,
+	}
+}
+
+type webhookDeliveryResp struct {
+	Id             uuid.UUID       `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	ResponseStatus *int32          `json:"response_status,omitempty"`
+	ResponseBody   string          `json:"response_body,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+}
+
+func (cfg *apiConfig) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeJSON[createWebhookParams](w, r)
+	if err != nil {
+		respondWithDecodeErr(w, err)
+		return
+	}
+
+	if err := webhook.CheckURL(params.URL); err != nil {
+		respondWithErr(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	var types []string
+	for _, t := range params.EventTypes {
+		if !slices.Contains(webhookEvents, t) {
+			respondWithErr(w, http.StatusBadRequest,
+				fmt.Sprintf("unknown event type %q, must be one of %s", t, strings.Join(webhookEvents, ", ")), nil)
+			return
+		}
+		if !slices.Contains(types, t) {
+			types = append(types, t)
+		}
+	}
+	slices.Sort(types)
+
+	secret := params.Secret
+	switch {
+	case secret == "":
+		secret, err = auth.MakeOpaqueToken()
+		if err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "Couldn't create webhook secret", err)
+			return
+		}
+	case len(secret) < minWebhookSecret:
+		respondWithErr(w, http.StatusBadRequest, fmt.Sprintf("secret must be at least %d characters", minWebhookSecret), nil)
+		return
+	}
+
+	hook, err := cfg.dbQueries.CreateWebhook(r.Context(), database.CreateWebhookParams{
+		UserID:     principal(r).UserID,
+		Url:        params.URL,
+		EventTypes: types,
+		Secret:     secret,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't create webhook", err)
+		return
+	}
+
+	res := newWebhookResp(hook)
+	res.Secret = secret
+	respondWithJson(w, http.StatusCreated, res)
+}
+
+// handleListWebhooks lists the caller's webhooks, or with ?all=true, for
+// admins, everyone's.
+func (cfg *apiConfig) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	p := principal(r)
+
+	var hooks []database.Webhook
+	var err error
+	if r.URL.Query().Get("all") == "true" {
+		if !cfg.admins[p.UserID] {
+			respondWithErr(w, http.StatusForbidden, "Admins only", nil)
+			return
+		}
+		hooks, err = cfg.dbQueries.ListAllWebhooks(r.Context())
+	} else {
+		hooks, err = cfg.dbQueries.ListWebhooks(r.Context(), p.UserID)
+	}
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't list webhooks", err)
+		return
+	}
+
+	res := []webhookResp{}
+	for _, h := range hooks {
+		res = append(res, newWebhookResp(h))
+	}
+	respondWithJson(w, http.StatusOK, res)
+}
+
+// requestWebhook loads the webhook in the path, if the caller owns it or is
+// an admin. Otherwise it has answered with 404.
+func (cfg *apiConfig) requestWebhook(w http.ResponseWriter, r *http.Request) (database.Webhook, bool) {
+	id, err := uuid.Parse(r.PathValue("webhookID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "invalid uuid format", err)
+		return database.Webhook{}, false
+	}
+
+	hook, err := cfg.dbQueries.GetWebhook(r.Context(), id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't look up webhook", err)
+		return database.Webhook{}, false
+	}
+	userID := principal(r).UserID
+	if err != nil || (hook.UserID != userID && !cfg.admins[userID]) {
+		respondWithErr(w, http.StatusNotFound, "Webhook not found", nil)
+		return database.Webhook{}, false
+	}
+	return hook, true
+}
+
+func (cfg *apiConfig) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := cfg.requestWebhook(w, r)
+	if !ok {
+		return
+	}
+	respondWithJson(w, http.StatusOK, newWebhookResp(hook))
+}
+
+func (cfg *apiConfig) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := cfg.requestWebhook(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.dbQueries.DeleteWebhook(r.Context(), hook.ID); err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't delete webhook", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleEnableWebhook turns a webhook back on after it was disabled for
+// failing, with a clean failure count. Deliveries missed meanwhile aren't
+// sent.
+func (cfg *apiConfig) handleEnableWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := cfg.requestWebhook(w, r)
+	if !ok {
+		return
+	}
+	hook, err := cfg.dbQueries.EnableWebhook(r.Context(), hook.ID)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't enable webhook", err)
+		return
+	}
+	respondWithJson(w, http.StatusOK, newWebhookResp(hook))
+}
+
+// handleListWebhookDeliveries is the delivery log, newest first.
+func (cfg *apiConfig) handleListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	hook, ok := cfg.requestWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	limit := defaultWebhookDeliveries
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxWebhookDeliveries {
+			respondWithErr(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxWebhookDeliveries), err)
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := cfg.dbQueries.ListWebhookDeliveries(r.Context(), database.ListWebhookDeliveriesParams{
+		WebhookID: hook.ID,
+		Limit:     int32(limit),
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't list deliveries", err)
+		return
+	}
+
+	res := []webhookDeliveryResp{}
+	for _, d := range deliveries {
+		dr := webhookDeliveryResp{
+			Id:            d.ID,
+			CreatedAt:     d.CreatedAt,
+			EventType:     d.EventType,
+			Payload:       d.Payload,
+			Status:        d.Status,
+			Attempts:      d.Attempts,
+			LastAttemptAt: nullTimePtr(d.LastAttemptAt),
+			ResponseBody:  d.ResponseBody.String,
+			LastError:     d.LastError.String,
+		}
+		if d.ResponseStatus.Valid {
+			dr.ResponseStatus = &d.ResponseStatus.Int32
+		}
+		res = append(res, dr)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, http.StatusOK, res)
+}
+
+// registerWebhookJobs sets up delivery on the job queue. An event becomes
+// one fanout job, queued by the instance that published it; that job queues
+// a delivery job per subscribed webhook, which the queue retries with
+// backoff. Owners are notified when their webhook is disabled for failing.
+func (cfg *apiConfig) registerWebhookJobs() {
+	cfg.webhooks.OnDisable = cfg.notifyWebhookDisabled
+	cfg.jobQueue.Handle(jobWebhookFanout, cfg.fanOutWebhooks)
+	cfg.jobQueue.Handle(jobWebhookDeliver, func(ctx context.Context, payload json.RawMessage) error {
+		var job struct {
+			DeliveryID uuid.UUID `json:"delivery_id"`
+		}
+		if err := json.Unmarshal(payload, &job); err != nil {
+			return err
+		}
+		return cfg.webhooks.Deliver(ctx, job.DeliveryID)
+	})
+}
+
+func (cfg *apiConfig) notifyWebhookDisabled(ctx context.Context, hook database.Webhook, reason string) {
+	err := cfg.notify(ctx, hook.UserID, notificationWebhookDisabled, uuid.Nil, uuid.Nil, struct {
+		WebhookID uuid.UUID `json:"webhook_id"`
+		URL       string    `json:"url"`
+		Reason    string    `json:"reason"`
+	}{
+		WebhookID: hook.ID,
+		URL:       hook.Url,
+		Reason:    reason,
+	})
+	if err != nil {
+		log.Printf("notify user %s about disabled webhook %s: %v", hook.UserID, hook.ID, err)
+	}
+}
+
+// queueWebhooks hands e to the webhooks, if they can subscribe to it.
+func (cfg *apiConfig) queueWebhooks(ctx context.Context, e events.Event) error {
+	if !slices.Contains(webhookEvents, e.Type) {
+		return nil
+	}
+	_, err := cfg.jobQueue.Enqueue(ctx, jobWebhookFanout, e)
+	return err
+}
+
+// fanOutWebhooks logs a delivery per active webhook subscribed to the event
+// and queues it, all in one transaction so a retry doesn't deliver twice.
+func (cfg *apiConfig) fanOutWebhooks(ctx context.Context, payload json.RawMessage) error {
+	var e events.Event
+	if err := json.Unmarshal(payload, &e); err != nil {
+		return err
+	}
+
+	return cfg.tx.InTx(ctx, func(q *database.Queries) error {
+		hooks, err := q.ListActiveWebhooksForEvent(ctx, e.Type)
+		if err != nil {
+			return err
+		}
+		for _, h := range hooks {
+			d, err := q.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{
+				WebhookID: h.ID,
+				EventType: e.Type,
+				Payload:   e.Data,
+			})
+			if err != nil {
+				return err
+			}
+			_, err = cfg.jobQueue.EnqueueWith(ctx, q, jobWebhookDeliver, map[string]uuid.UUID{"delivery_id": d.ID}, time.Now(), cfg.webhooks.MaxAttempts)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharath070/Chirpy/internal/auth"
+	"github.com/sharath070/Chirpy/internal/stream"
+	"github.com/sharath070/Chirpy/internal/websocket"
+)
+
+/*
+	GET /api/stream/ws speaks JSON text messages. The client subscribes to
+	channels:
+
+		{"type": "subscribe", "channel": "notifications"}
+		{"type": "subscribe", "channel": "chirps", "author_id": "...", "hashtag": "go"}
+		{"type": "unsubscribe", "channel": "chirps"}
+
+	and gets back
+
+		{"type": "subscribed", "channel": "chirps"}
+		{"type": "notification", "data": {...}}
+		{"type": "chirp", "event": "created", "data": {...}}
+		{"type": "error", "error": "..."}
+
+	An "id" on a request is echoed in its answer. Subscribing to a channel
+	again replaces its filters. Nothing is replayed: after a reconnect,
+	clients reload GET /api/notifications and the timeline.
+
+	A client that doesn't keep up with what it subscribed to is disconnected
+	with 1013 (try again later) rather than buffered for without limit.
+*/
+
+const (
+	wsNotificationsChannel = "notifications"
+	wsChirpsChannel        = "chirps"
+)
+
+const (
+	// how often we ping, and how long a client has to show signs of life
+	wsPingInterval = 30 * time.Second
+	wsPongWait     = wsPingInterval + 10*time.Second
+	// a client that can't take a write for this long is gone
+	wsWriteTimeout = 10 * time.Second
+	// how long to wait for the client's answer to our close
+	wsCloseWait = 2 * time.Second
+	// messages waiting for a client before it counts as too slow
+	wsSendQueue = 64
+	// client messages are small requests
+	wsMaxMessageSize = 4 << 10
+)
+
+type wsRequest struct {
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type"`
+	Channel  string `json:"channel"`
+	AuthorID string `json:"author_id,omitempty"`
+	Hashtag  string `json:"hashtag,omitempty"`
+}
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Channel string          `json:"channel,omitempty"`
+	Event   string          `json:"event,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// wsSession is one open WebSocket. The handler goroutine reads, writeLoop
+// writes, and each subscription forwards hub events into send.
+type wsSession struct {
+	cfg  *apiConfig
+	conn *websocket.Conn
+	p    auth.Principal
+	// the personal access token the socket was opened with, if any, to
+	// check again that it hasn't been revoked
+	pat  string
+	send chan []byte
+
+	closeOnce sync.Once
+	done      chan struct{}
+	closeCode int
+	closeText string
+
+	mu   sync.Mutex
+	subs map[string]*stream.Subscription
+}
+
+// handleWebSocket upgrades to a WebSocket for live notifications and
+// chirps. It takes the same credentials as the rest of the API; browsers,
+// which can't set headers on a WebSocket, use cookie sessions.
+func (cfg *apiConfig) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// a GET with cookies attached isn't covered by the CSRF check, so make
+	// sure another site's page isn't opening the socket as our user
+	if !cfg.sameOrigin(r) {
+		respondWithErr(w, http.StatusForbidden, "cross-origin WebSocket not allowed", nil)
+		return
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	conn.MaxMessageSize = wsMaxMessageSize
+
+	s := &wsSession{
+		cfg:  cfg,
+		conn: conn,
+		p:    principal(r),
+		send: make(chan []byte, wsSendQueue),
+		done: make(chan struct{}),
+		subs: map[string]*stream.Subscription{},
+	}
+	if token, fromCookie, err := cfg.requestToken(r); err == nil && !fromCookie && auth.IsPersonalAccessToken(token) {
+		s.pat = token
+	}
+
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		s.writeLoop()
+	}()
+
+	s.readLoop()
+
+	s.close(websocket.CloseNormal, "")
+	<-written
+	conn.Close()
+
+	s.mu.Lock()
+	for _, sub := range s.subs {
+		sub.Close()
+	}
+	s.mu.Unlock()
+}
+
+// sameOrigin accepts requests without an Origin (not from a browser) and
+// those from our own site.
+func (cfg *apiConfig) sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	public, err := url.Parse(cfg.publicURL)
+	return err == nil && strings.EqualFold(u.Scheme, public.Scheme) && strings.EqualFold(u.Host, public.Host)
+}
+
+// close ends the session: writeLoop sends a close frame with code and
+// stops. Only the first call counts.
+func (s *wsSession) close(code int, text string) {
+	s.closeOnce.Do(func() {
+		s.closeCode, s.closeText = code, text
+		close(s.done)
+	})
+}
+
+func (s *wsSession) readLoop() {
+	s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	s.conn.PongHandler = func([]byte) {
+		s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	}
+
+	for {
+		op, data, err := s.conn.ReadMessage()
+		if err != nil {
+			var ce *websocket.CloseError
+			if !errors.As(err, &ce) {
+				s.close(websocket.CloseGoingAway, "")
+			}
+			return
+		}
+		select {
+		case <-s.done:
+			// closing; whatever the client still says doesn't matter
+			return
+		default:
+		}
+		s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		if op != websocket.TextMessage {
+			s.enqueue(wsMessage{Type: "error", Error: "messages must be JSON text"})
+			continue
+		}
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			s.enqueue(wsMessage{Type: "error", Error: "invalid JSON"})
+			continue
+		}
+		s.handleRequest(req)
+	}
+}
+
+func (s *wsSession) handleRequest(req wsRequest) {
+	fail := func(msg string) {
+		s.enqueue(wsMessage{ID: req.ID, Type: "error", Channel: req.Channel, Error: msg})
+	}
+
+	switch req.Type {
+	case "subscribe":
+		var sub *stream.Subscription
+		switch req.Channel {
+		case wsNotificationsChannel:
+			if !s.p.HasScope(auth.ScopeNotifications) {
+				fail("token lacks the " + auth.ScopeNotifications + " scope")
+				return
+			}
+			topic := "user:" + s.p.UserID.String()
+			sub, _, _ = s.cfg.notificationHub.Subscribe(0, func(e stream.Event) bool {
+				return e.HasTopic(topic)
+			})
+		case wsChirpsChannel:
+			if !s.p.HasScope(auth.ScopeChirpsRead) {
+				fail("token lacks the " + auth.ScopeChirpsRead + " scope")
+				return
+			}
+			var author uuid.UUID
+			if req.AuthorID != "" {
+				id, err := uuid.Parse(req.AuthorID)
+				if err != nil {
+					fail("invalid author_id")
+					return
+				}
+				author = id
+			}
+			tag := normalizeHashtag(req.Hashtag)
+			sub, _, _ = s.cfg.chirpHub.Subscribe(0, func(e stream.Event) bool {
+				if author != uuid.Nil && !e.HasTopic("author:"+author.String()) {
+					return false
+				}
+				return tag == "" || e.HasTopic("hashtag:"+tag)
+			})
+		default:
+			fail("unknown channel")
+			return
+		}
+
+		s.mu.Lock()
+		if old := s.subs[req.Channel]; old != nil {
+			old.Close()
+		}
+		s.subs[req.Channel] = sub
+		s.mu.Unlock()
+
+		s.enqueue(wsMessage{ID: req.ID, Type: "subscribed", Channel: req.Channel})
+		go s.forward(req.Channel, sub)
+
+	case "unsubscribe":
+		s.mu.Lock()
+		if sub := s.subs[req.Channel]; sub != nil {
+			sub.Close()
+			delete(s.subs, req.Channel)
+		}
+		s.mu.Unlock()
+		s.enqueue(wsMessage{ID: req.ID, Type: "unsubscribed", Channel: req.Channel})
+
+	default:
+		fail("unknown message type")
+	}
+}
+
+// forward copies a subscription's events into the send queue until it ends.
+func (s *wsSession) forward(channel string, sub *stream.Subscription) {
+	for e := range sub.C {
+		msg := wsMessage{Type: "notification", Data: e.Data}
+		if channel == wsChirpsChannel {
+			msg = wsMessage{Type: "chirp", Event: e.Type, Data: e.Data}
+		}
+		s.enqueue(msg)
+	}
+	if sub.Dropped() {
+		s.close(websocket.CloseTryAgainLater, "too slow, reconnect")
+	}
+}
+
+// enqueue never blocks: a client with a full send queue is disconnected.
+func (s *wsSession) enqueue(msg wsMessage) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("encode websocket message: %v", err)
+		return
+	}
+	select {
+	case s.send <- b:
+	default:
+		s.close(websocket.CloseTryAgainLater, "too slow, reconnect")
+	}
+}
+
+func (s *wsSession) writeLoop() {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	// the socket lives no longer than the token that opened it
+	var expired <-chan time.Time
+	if !s.p.ExpiresAt.IsZero() {
+		t := time.NewTimer(time.Until(s.p.ExpiresAt))
+		defer t.Stop()
+		expired = t.C
+	}
+
+	write := func(op int, data []byte) bool {
+		s.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := s.conn.WriteMessage(op, data); err != nil {
+			// unblocks readLoop
+			s.conn.Close()
+			s.close(websocket.CloseGoingAway, "")
+			return false
+		}
+		return true
+	}
+
+	for {
+		select {
+		case b := <-s.send:
+			if !write(websocket.TextMessage, b) {
+				return
+			}
+		case <-ping.C:
+			if !s.stillAuthorized() {
+				s.close(websocket.ClosePolicyViolation, "credentials revoked")
+				continue
+			}
+			if !write(websocket.PingMessage, nil) {
+				return
+			}
+		case <-expired:
+			s.close(websocket.ClosePolicyViolation, "token expired")
+		case <-s.done:
+			s.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			s.conn.WriteClose(s.closeCode, s.closeText)
+			// give the client a moment to answer, then readLoop gives up
+			s.conn.SetReadDeadline(time.Now().Add(wsCloseWait))
+			return
+		}
+	}
+}
+
+// stillAuthorized checks again that the credentials the socket was opened
+// with haven't been revoked. The revocation list only covers login sessions,
+// so PATs and OAuth tokens are looked up in the database, as middlewareAuth
+// does on every request. If the database can't say, the socket stays open.
+func (s *wsSession) stillAuthorized() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), wsWriteTimeout)
+	defer cancel()
+
+	var err error
+	switch {
+	case s.pat != "":
+		_, err = s.cfg.authenticatePAT(ctx, s.pat)
+	case s.p.ClientID != "":
+		_, err = s.cfg.authenticateOAuthAccessToken(ctx, s.p)
+	default:
+		return !s.cfg.revocations.Revoked(s.p)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		log.Printf("recheck websocket credentials for user %s: %v", s.p.UserID, err)
+	}
+	return true
+}